@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Most suggestions Discord shows for an option
+const maxChoices = 25
+
+// Returns the subcommand being typed, inside its group if it has one
+func typedSubcommand(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	if len(options) == 0 {
+		return nil
+	}
+	command := options[0]
+	if command.Type == discordgo.ApplicationCommandOptionSubCommandGroup && len(command.Options) > 0 {
+		return command.Options[0]
+	}
+	return command
+}
+
+// Returns the option the user is typing
+func focusedOption(options []*discordgo.ApplicationCommandInteractionDataOption) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, opt := range options {
+		if opt.Focused {
+			return opt
+		}
+	}
+	return nil
+}
+
+// Returns the values containing what the user typed, as choices
+func filterChoices(values []string, typed string) []*discordgo.ApplicationCommandOptionChoice {
+	typed = strings.ToLower(typed)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, value := range values {
+		if value == "" || !strings.Contains(strings.ToLower(value), typed) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: value, Value: value})
+		if len(choices) == maxChoices {
+			break
+		}
+	}
+	return choices
+}
+
+// Returns the IDs of the matches a command can be run on: finished matches
+// when editing a result, else the matches being played
+func matchIDSuggestions(tournament *Tournament, finished bool) []string {
+	var ids []string
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			if finished && match.Winner != "" && !match.Bye {
+				ids = append(ids, match.ID)
+			}
+			if !finished && isMatchReady(match) {
+				ids = append(ids, match.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// Returns the suggestions for the option being typed in a subcommand
+func autocompleteChoices(guildID string, db *Database, command *discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice {
+	if command == nil {
+		return nil
+	}
+	options := command.Options
+	focused := focusedOption(options)
+	if focused == nil {
+		return nil
+	}
+	typed := focused.StringValue()
+
+	switch focused.Name {
+	case "username":
+		var usernames []string
+		for _, player := range db.Players {
+			usernames = append(usernames, player.Username)
+		}
+		return filterChoices(usernames, typed)
+	case "match_id":
+		tournament := getCurrentTournament(db)
+		if tournament == nil {
+			return nil
+		}
+		// Only /smashbot match edit runs on finished matches
+		return filterChoices(matchIDSuggestions(tournament, command.Name == "edit"), typed)
+	case "winner":
+		matchID := getOption(options, "match_id")
+		if matchID == nil {
+			return nil
+		}
+		match, err := dataStore.FindMatch(guildID, matchID.StringValue())
+		if err != nil {
+			log.Printf("Error finding match: %v", err)
+			return nil
+		}
+		if match == nil {
+			return nil
+		}
+		return filterChoices([]string{match.Player1, match.Player2}, typed)
+	}
+	return nil
+}
+
+// Suggests values for the option being typed, from the last saved data of the server
+func handleAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	db, err := state.snapshot(i.GuildID)
+	if err != nil {
+		log.Printf("Error loading database: %v", err)
+		return
+	}
+	choices := autocompleteChoices(i.GuildID, db, typedSubcommand(i.ApplicationCommandData().Options))
+	if choices == nil {
+		choices = []*discordgo.ApplicationCommandOptionChoice{}
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending suggestions: %v", err)
+	}
+}
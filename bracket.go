@@ -0,0 +1,417 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/bits"
+)
+
+// Builds every round of an elimination bracket from the first round slots.
+// Slots are paired two by two and an empty slot is a bye. With double set,
+// losers of each winners round drop into the losers bracket and the bracket
+// ends with grand finals. Rounds are returned in the order they can be played.
+func buildEliminationBracket(slots []string, double bool) []Round {
+	size := len(slots)
+	numWinnersRounds := bits.Len(uint(size)) - 1
+
+	winners := make([]Round, numWinnersRounds)
+	for r := range winners {
+		winners[r] = Round{
+			ID:      fmt.Sprintf("R%d", r+1),
+			Number:  r + 1,
+			Bracket: BracketWinners,
+			Matches: make([]Match, size>>(r+1)),
+		}
+		for m := range winners[r].Matches {
+			match := Match{
+				ID:      fmt.Sprintf("R%dM%d", r+1, m+1),
+				Bracket: BracketWinners,
+			}
+			if r == 0 {
+				match.Player1 = slots[2*m]
+				match.Player2 = slots[2*m+1]
+			}
+			if r+1 < numWinnersRounds {
+				match.NextmatchID = fmt.Sprintf("R%dM%d", r+2, m/2+1)
+				match.NextMatchSlot = m%2 + 1
+			}
+			winners[r].Matches[m] = match
+		}
+	}
+
+	if !double {
+		return pruneByes(winners)
+	}
+
+	// Losers round 2j-1 pairs up survivors, losers round 2j takes the losers
+	// of winners round j+1
+	numLosersRounds := 2 * (numWinnersRounds - 1)
+	losers := make([]Round, numLosersRounds)
+	for l := range losers {
+		losers[l] = Round{
+			ID:      fmt.Sprintf("L%d", l+1),
+			Number:  l + 1,
+			Bracket: BracketLosers,
+			Matches: make([]Match, size>>(2+l/2)),
+		}
+		for m := range losers[l].Matches {
+			match := Match{
+				ID:      fmt.Sprintf("L%dM%d", l+1, m+1),
+				Bracket: BracketLosers,
+			}
+			if l+1 < numLosersRounds {
+				next := m
+				match.NextMatchSlot = 1
+				if l%2 == 1 {
+					next = m / 2
+					match.NextMatchSlot = m%2 + 1
+				}
+				match.NextmatchID = fmt.Sprintf("L%dM%d", l+2, next+1)
+			}
+			losers[l].Matches[m] = match
+		}
+	}
+
+	grandFinals := Round{
+		ID:      "GF",
+		Number:  1,
+		Bracket: BracketGrandFinals,
+		Matches: []Match{{ID: "GF1", Bracket: BracketGrandFinals}},
+	}
+
+	// Winners bracket final and losers bracket final both feed grand finals
+	final := &winners[numWinnersRounds-1].Matches[0]
+	final.NextmatchID = "GF1"
+	final.NextMatchSlot = 1
+	if numLosersRounds > 0 {
+		losersFinal := &losers[numLosersRounds-1].Matches[0]
+		losersFinal.NextmatchID = "GF1"
+		losersFinal.NextMatchSlot = 2
+	}
+
+	// Drop the losers of each winners round into the losers bracket
+	for r := range winners {
+		for m := range winners[r].Matches {
+			match := &winners[r].Matches[m]
+			switch {
+			case numLosersRounds == 0:
+				match.LoserMatchID = "GF1"
+				match.LoserMatchSlot = 2
+			case r == 0:
+				match.LoserMatchID = fmt.Sprintf("L1M%d", m/2+1)
+				match.LoserMatchSlot = m%2 + 1
+			default:
+				target := m
+				// Every other round drops in reverse order to delay rematches
+				if r%2 == 1 {
+					target = len(winners[r].Matches) - 1 - m
+				}
+				match.LoserMatchID = fmt.Sprintf("L%dM%d", 2*r, target+1)
+				match.LoserMatchSlot = 2
+			}
+		}
+	}
+
+	rounds := []Round{winners[0]}
+	for r := 1; r < numWinnersRounds; r++ {
+		rounds = append(rounds, winners[r], losers[2*r-2], losers[2*r-1])
+	}
+	rounds = append(rounds, grandFinals)
+	return pruneByes(rounds)
+}
+
+// Slot of a match a player is sent to
+type matchSlot struct {
+	matchID string
+	slot    int
+}
+
+// Removes matches that can never be played because of byes. A match missing
+// one player becomes a bye the other player passes through, a match missing
+// both players is dropped. Known bye winners are moved forward right away.
+// A losers bracket bye whose player drops in from the winners bracket is
+// skipped: the loser drops straight into the match after it, so a player who
+// had a bye in the winners bracket never gets a second one.
+func pruneByes(rounds []Round) []Round {
+	empty := make(map[string][2]bool)
+	// Winners matches whose loser is sent to each slot
+	dropIns := make(map[matchSlot]string)
+	for _, round := range rounds {
+		for _, match := range round.Matches {
+			if round.Number == 1 && round.Bracket == BracketWinners {
+				empty[match.ID] = [2]bool{match.Player1 == "", match.Player2 == ""}
+			}
+			if match.LoserMatchID != "" {
+				dropIns[matchSlot{match.LoserMatchID, match.LoserMatchSlot}] = match.ID
+			}
+		}
+	}
+	skipped := make(map[string]matchSlot)
+
+	markEmpty := func(matchID string, slot int) {
+		if matchID == "" {
+			return
+		}
+		slots := empty[matchID]
+		slots[slot-1] = true
+		empty[matchID] = slots
+	}
+
+	var pruned []Round
+	for _, round := range rounds {
+		kept := round
+		kept.Matches = nil
+		for _, match := range round.Matches {
+			slots := empty[match.ID]
+			switch {
+			case slots[0] && slots[1]:
+				markEmpty(match.NextmatchID, match.NextMatchSlot)
+				markEmpty(match.LoserMatchID, match.LoserMatchSlot)
+				continue
+			case slots[0] || slots[1]:
+				filled := 1
+				if slots[0] {
+					filled = 2
+				}
+				if from, ok := dropIns[matchSlot{match.ID, filled}]; ok && match.Bracket == BracketLosers && match.NextmatchID != "" {
+					next := matchSlot{match.NextmatchID, match.NextMatchSlot}
+					skipped[from] = next
+					dropIns[next] = from
+					continue
+				}
+				markEmpty(match.LoserMatchID, match.LoserMatchSlot)
+				match.Bye = true
+				match.LoserMatchID = ""
+				match.LoserMatchSlot = 0
+				if match.Player1 == "" {
+					match.Player1, match.Player2 = match.Player2, ""
+				}
+			}
+			kept.Matches = append(kept.Matches, match)
+		}
+		if len(kept.Matches) > 0 {
+			pruned = append(pruned, kept)
+		}
+	}
+
+	t := &Tournament{Rounds: pruned}
+	for r := range t.Rounds {
+		for m := range t.Rounds[r].Matches {
+			match := &t.Rounds[r].Matches[m]
+			if next, ok := skipped[match.ID]; ok {
+				match.LoserMatchID, match.LoserMatchSlot = next.matchID, next.slot
+			}
+		}
+	}
+	for r := range t.Rounds {
+		for m := range t.Rounds[r].Matches {
+			match := &t.Rounds[r].Matches[m]
+			if match.Bye && match.Player1 != "" && match.Winner == "" {
+				match.Winner = match.Player1
+				advanceMatch(t, match)
+			}
+		}
+	}
+	return t.Rounds
+}
+
+// Returns the order of seeds in the first round slots of a bracket, so that
+// seed 1 meets the lowest seed and the top two seeds can only meet in the final
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := make([]int, 0, len(order)*2)
+		for _, seed := range order {
+			next = append(next, seed, 2*len(order)+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// Returns the round in which the players in two first round slots can meet
+func meetingRound(slotA, slotB int) int {
+	return bits.Len(uint(slotA ^ slotB))
+}
+
+// Returns the match with the given ID
+func findMatch(tournament *Tournament, matchID string) *Match {
+	for i := range tournament.Rounds {
+		for j := range tournament.Rounds[i].Matches {
+			if tournament.Rounds[i].Matches[j].ID == matchID {
+				return &tournament.Rounds[i].Matches[j]
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the player who lost a finished match
+func matchLoser(match Match) string {
+	if match.Winner == "" || match.Bye {
+		return ""
+	}
+	if match.Winner == match.Player1 {
+		return match.Player2
+	}
+	return match.Player1
+}
+
+// Sends the winner and the loser of a finished match to the matches waiting for them
+func advanceMatch(tournament *Tournament, match *Match) {
+	if match.NextmatchID != "" {
+		placePlayer(tournament, match.NextmatchID, match.NextMatchSlot, match.Winner)
+	}
+	if match.LoserMatchID != "" {
+		placePlayer(tournament, match.LoserMatchID, match.LoserMatchSlot, matchLoser(*match))
+	}
+	if match.ID == "GF1" {
+		createGrandFinalsReset(tournament, match)
+	}
+}
+
+// Adds a deciding set when the player coming from the losers bracket wins grand finals
+func createGrandFinalsReset(tournament *Tournament, match *Match) {
+	if match.Winner != match.Player2 || findMatch(tournament, "GF2") != nil {
+		return
+	}
+	tournament.Rounds = append(tournament.Rounds, Round{
+		ID:      "GFR",
+		Number:  2,
+		Bracket: BracketGrandFinals,
+		Matches: []Match{{
+			ID:      "GF2",
+			Player1: match.Player1,
+			Player2: match.Player2,
+			Bracket: BracketGrandFinals,
+		}},
+	})
+	log.Print("Grand finals reset created")
+}
+
+// Puts a player in a slot of a match, a bye is won right away
+func placePlayer(tournament *Tournament, matchID string, slot int, player string) {
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return
+	}
+	if match.Bye {
+		match.Player1 = player
+		match.Winner = player
+		advanceMatch(tournament, match)
+		return
+	}
+	if slot == 1 {
+		match.Player1 = player
+	} else {
+		match.Player2 = player
+	}
+}
+
+// Reports whether a match has both players and no winner yet
+func isMatchReady(match Match) bool {
+	return match.Player1 != "" && match.Player2 != "" && match.Winner == ""
+}
+
+// Gives free tables to ready matches, in the order the rounds are played. A
+// player plays one match at a time: a match waits while one of its players is
+// seated or waiting for a table in an earlier round.
+func assignTables(tournament *Tournament) {
+	busy := make(map[string]bool)
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			if isMatchReady(match) && match.TableID != "" {
+				busy[match.Player1] = true
+				busy[match.Player2] = true
+			}
+		}
+	}
+
+	for r := range tournament.Rounds {
+		for m := range tournament.Rounds[r].Matches {
+			match := &tournament.Rounds[r].Matches[m]
+			if !isMatchReady(*match) || match.TableID != "" {
+				continue
+			}
+			waiting := busy[match.Player1] || busy[match.Player2]
+			busy[match.Player1] = true
+			busy[match.Player2] = true
+			if waiting {
+				continue
+			}
+			for t := range tournament.Tables {
+				if tournament.Tables[t].Available {
+					tournament.Tables[t].Available = false
+					tournament.Tables[t].MatchID = match.ID
+					match.TableID = tournament.Tables[t].ID
+					break
+				}
+			}
+		}
+	}
+}
+
+// Frees the table used by a match
+func releaseTable(tournament *Tournament, match *Match) {
+	for t := range tournament.Tables {
+		if tournament.Tables[t].MatchID == match.ID {
+			tournament.Tables[t].Available = true
+			tournament.Tables[t].MatchID = ""
+		}
+	}
+}
+
+// Returns the display name of a round
+func roundName(round Round) string {
+	switch round.Bracket {
+	case BracketLosers:
+		return fmt.Sprintf("Losers Round %d", round.Number)
+	case BracketGrandFinals:
+		if round.Number > 1 {
+			return "Grand Finals Reset"
+		}
+		return "Grand Finals"
+	case BracketPools:
+		return fmt.Sprintf("Pools Round %d", round.Number)
+	case BracketSwiss:
+		return fmt.Sprintf("Swiss Round %d", round.Number)
+	}
+	return fmt.Sprintf("Winners Round %d", round.Number)
+}
+
+// Moves the current round forward and completes the phase once its last match is played.
+// Grand finals only complete the phase when no reset is needed. The tournament is
+// complete when its last phase is.
+func updateTournamentProgress(tournament *Tournament) {
+	applyBestOf(tournament)
+	assignTables(tournament)
+	for r, round := range tournament.Rounds {
+		if round.Phase != tournament.CurrentPhase {
+			continue
+		}
+		tournament.CurrentRound = r
+		for _, match := range round.Matches {
+			if match.Winner == "" {
+				return
+			}
+		}
+	}
+	phase := currentPhase(tournament)
+	// Swiss rounds are paired one at a time by the next round command
+	if phase.Format == FormatSwiss && tournament.Rounds[tournament.CurrentRound].Number < phase.SwissRounds {
+		return
+	}
+	phase.Status = TournamentStatusComplete
+	if tournament.CurrentPhase+1 == len(tournament.Phases) {
+		tournament.Status = TournamentStatusComplete
+	}
+}
+
+// Returns the winner of a complete tournament
+func tournamentWinner(tournament *Tournament) string {
+	if len(tournament.Rounds) == 0 {
+		return ""
+	}
+	lastRound := tournament.Rounds[len(tournament.Rounds)-1]
+	return lastRound.Matches[0].Winner
+}
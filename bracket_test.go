@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Returns n player names in seed order
+func seededPlayers(n int) []string {
+	players := make([]string, n)
+	for i := range players {
+		players[i] = fmt.Sprintf("seed%03d", i+1)
+	}
+	return players
+}
+
+// Plays every match of a bracket. The better seed wins, or the worse one with upsets set.
+func playBracket(t *testing.T, rounds []Round, upsets bool) (*Tournament, int) {
+	t.Helper()
+	tournament := &Tournament{
+		Rounds: rounds,
+		Phases: []Phase{{Status: TournamentStatusOngoing}},
+		Status: TournamentStatusOngoing,
+	}
+	updateTournamentProgress(tournament)
+
+	played := 0
+	for tournament.Status != TournamentStatusComplete {
+		var ready *Match
+		for r := range tournament.Rounds {
+			for m := range tournament.Rounds[r].Matches {
+				if ready == nil && isMatchReady(tournament.Rounds[r].Matches[m]) {
+					ready = &tournament.Rounds[r].Matches[m]
+				}
+			}
+		}
+		if ready == nil {
+			t.Fatalf("bracket is stuck after %d matches", played)
+		}
+
+		better, worse := ready.Player1, ready.Player2
+		if worse < better {
+			better, worse = worse, better
+		}
+		ready.Winner = better
+		if upsets {
+			ready.Winner = worse
+		}
+		advanceMatch(tournament, ready)
+		updateTournamentProgress(tournament)
+		played++
+	}
+	return tournament, played
+}
+
+func TestFirstRoundByes(t *testing.T) {
+	for n := 2; n <= 128; n++ {
+		players := seededPlayers(n)
+		slots := firstRound(players)
+
+		size := LargestPowerOfTwo(n)
+		if len(slots) != size {
+			t.Fatalf("%d players: got %d slots, want %d", n, len(slots), size)
+		}
+
+		seen := make(map[string]bool)
+		byes := make(map[string]bool)
+		for m := 0; m < len(slots); m += 2 {
+			p1, p2 := slots[m], slots[m+1]
+			if p1 == "" && p2 == "" {
+				t.Errorf("%d players: match %d has no player", n, m/2+1)
+			}
+			for _, p := range []string{p1, p2} {
+				if p == "" {
+					continue
+				}
+				if seen[p] {
+					t.Errorf("%d players: %s placed twice", n, p)
+				}
+				seen[p] = true
+			}
+			if p1 == "" {
+				byes[p2] = true
+			}
+			if p2 == "" {
+				byes[p1] = true
+			}
+		}
+		if len(seen) != n {
+			t.Errorf("%d players: %d placed", n, len(seen))
+		}
+
+		// Byes go to the top seeds
+		for seed := 1; seed <= size-n; seed++ {
+			if !byes[players[seed-1]] {
+				t.Errorf("%d players: seed %d has no bye", n, seed)
+			}
+		}
+
+		// Byes are spread evenly between both halves of every part of the bracket
+		for block := 4; block <= size; block *= 2 {
+			for start := 0; start < size; start += block {
+				left, right := 0, 0
+				for slot := start; slot < start+block; slot++ {
+					if slots[slot] == "" {
+						if slot < start+block/2 {
+							left++
+						} else {
+							right++
+						}
+					}
+				}
+				if left-right > 1 || right-left > 1 {
+					t.Errorf("%d players: %d byes on one side and %d on the other of slots %d-%d", n, left, right, start, start+block-1)
+				}
+			}
+		}
+	}
+}
+
+func TestEliminationBracketByes(t *testing.T) {
+	for _, double := range []bool{false, true} {
+		for n := 2; n <= 128; n++ {
+			for _, upsets := range []bool{false, true} {
+				players := seededPlayers(n)
+				tournament, played := playBracket(t, buildEliminationBracket(firstRound(players), double), upsets)
+
+				wantPlayed := n - 1
+				if double {
+					wantPlayed = 2*n - 2
+					if findMatch(tournament, "GF2") != nil {
+						wantPlayed++
+					}
+				}
+				if played != wantPlayed {
+					t.Errorf("%d players, double %v: %d matches played, want %d", n, double, played, wantPlayed)
+				}
+
+				losses := make(map[string]int)
+				winnersByes := make(map[string]int)
+				allByes := make(map[string]int)
+				for _, round := range tournament.Rounds {
+					for _, match := range round.Matches {
+						if match.Bye {
+							allByes[match.Winner]++
+							if match.Bracket == BracketWinners {
+								winnersByes[match.Winner]++
+							}
+							continue
+						}
+						losses[matchLoser(match)]++
+					}
+				}
+
+				winner := tournamentWinner(tournament)
+				if !upsets && winner != players[0] {
+					t.Errorf("%d players, double %v: %s won without upsets", n, double, winner)
+				}
+				maxLosses := 1
+				if double {
+					maxLosses = 2
+				}
+				for _, player := range players {
+					if player != winner && losses[player] != maxLosses {
+						t.Errorf("%d players, double %v: %s eliminated after %d losses", n, double, player, losses[player])
+					}
+					if winnersByes[player] > 1 {
+						t.Errorf("%d players, double %v: %s got %d byes", n, double, player, winnersByes[player])
+					}
+				}
+
+				for _, player := range players {
+					if allByes[player] > 1 {
+						t.Errorf("%d players, double %v: %s got %d byes", n, double, player, allByes[player])
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Minutes players have to check in before they are pinged again, when not set
+const defaultCheckInTimeout = 10
+
+// Prefix of the custom ID of check-in buttons, followed by the match ID
+const checkInButtonPrefix = "checkin"
+
+// Call-out sent when a match is ready at a table, and the players who answered it
+type Callout struct {
+	ChannelID string    `json:"channel_id"`
+	MessageID string    `json:"message_id"`
+	CalledAt  time.Time `json:"called_at"`
+	PingedAt  time.Time `json:"pinged_at"`
+	CheckedIn []string  `json:"checked_in,omitempty"`
+}
+
+// Returns the number of minutes players have to check in before they are pinged again
+func checkInTimeout(db *Database) time.Duration {
+	minutes := db.Settings.CheckInTimeout
+	if minutes <= 0 {
+		minutes = defaultCheckInTimeout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Changes the channel matches are called in and the minutes players have to
+// check in. Without a channel, matches are not called anymore.
+func setCallouts(db *Database, channelID string, minutes int) error {
+	if minutes < 0 {
+		return fmt.Errorf("the check-in timeout must be at least 1 minute")
+	}
+	db.Settings.CalloutChannel = channelID
+	if minutes > 0 {
+		db.Settings.CheckInTimeout = minutes
+	}
+	log.Print("Call-outs updated successfully")
+	return saveSettings(db)
+}
+
+// Returns the matches ready at a table that were not called yet
+func pendingCallouts(db *Database) []Match {
+	tournament := getCurrentTournament(db)
+	if tournament == nil || db.Settings.CalloutChannel == "" {
+		return nil
+	}
+	var pending []Match
+	for _, match := range readyMatches(tournament) {
+		if match.TableID != "" && match.Callout == nil {
+			pending = append(pending, match)
+		}
+	}
+	return pending
+}
+
+// Returns the discord ID of a player, empty when their account is not linked
+func playerDiscordID(db *Database, name string) string {
+	for _, p := range db.Players {
+		if p.Username == name {
+			return p.DiscordID
+		}
+	}
+	return ""
+}
+
+// Reports whether a player answered the call-out of a match
+func checkedIn(match Match, player string) bool {
+	if match.Callout == nil {
+		return false
+	}
+	for _, name := range match.Callout.CheckedIn {
+		if name == player {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the description of a called match: the players, the table and the best-of
+func calloutDescription(match Match) string {
+	description := fmt.Sprintf("%s vs %s\nTable: %s", match.Player1, match.Player2, match.TableID)
+	if match.BestOf > 0 {
+		description += fmt.Sprintf("\nBest of %d", match.BestOf)
+	}
+	if match.ThreadID != "" {
+		description += fmt.Sprintf("\nThread: <#%s>", match.ThreadID)
+	}
+	return description
+}
+
+// Returns the content, description and components of the call-out message of a match
+func calloutMessage(db *Database, match Match) (string, *discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	content := playerMentions(db, []string{match.Player1, match.Player2}) + ", your match is ready!"
+	description := calloutDescription(match)
+	var waiting []string
+	for _, player := range []string{match.Player1, match.Player2} {
+		if checkedIn(match, player) {
+			description += fmt.Sprintf("\n%s checked in", player)
+		} else {
+			waiting = append(waiting, player)
+		}
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       "Match " + match.ID,
+		Description: description,
+		Color:       0x00FF00,
+	}
+	if len(waiting) == 0 {
+		return content, embed, []discordgo.MessageComponent{}
+	}
+	return content, embed, []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Check in",
+					Style:    discordgo.SuccessButton,
+					CustomID: fmt.Sprintf("%s:%s", checkInButtonPrefix, match.ID),
+				},
+			},
+		},
+	}
+}
+
+// Message of a call-out or check-in reminder, built while the server is locked
+// and sent once it is unlocked so a slow Discord does not hold up its commands
+type calloutNotice struct {
+	matchID   string
+	channelID string
+	message   *discordgo.MessageSend
+	// Direct message to the players linked to a Discord account, whose IDs are kept by player
+	direct     *discordgo.MessageEmbed
+	discordIDs map[string]string
+}
+
+// Returns the Discord IDs of the players linked to an account, by player
+func playerDiscordIDs(db *Database, players []string) map[string]string {
+	discordIDs := make(map[string]string)
+	for _, player := range players {
+		if discordID := playerDiscordID(db, player); discordID != "" {
+			discordIDs[player] = discordID
+		}
+	}
+	return discordIDs
+}
+
+// Sends a direct message to players linked to a Discord account
+func messagePlayers(s *discordgo.Session, discordIDs map[string]string, embed *discordgo.MessageEmbed) {
+	for player, discordID := range discordIDs {
+		channel, err := s.UserChannelCreate(discordID)
+		if err != nil {
+			log.Printf("Error opening direct messages with %s: %v", player, err)
+			continue
+		}
+		if _, err := s.ChannelMessageSendEmbed(channel.ID, embed); err != nil {
+			log.Printf("Error sending direct message to %s: %v", player, err)
+		}
+	}
+}
+
+// Sends a notice to its channel and to its players. Returns the ID of the
+// channel message, empty when it could not be sent.
+func sendCalloutNotice(s *discordgo.Session, notice calloutNotice) string {
+	messageID := ""
+	message, err := s.ChannelMessageSendComplex(notice.channelID, notice.message)
+	if err != nil {
+		log.Printf("Error sending message for match %s: %v", notice.matchID, err)
+	} else {
+		messageID = message.ID
+	}
+	messagePlayers(s, notice.discordIDs, notice.direct)
+	return messageID
+}
+
+// Marks the matches of a server that became ready at a table as called and
+// returns their call-outs, all called at the returned time
+func callMatches(guildID string) ([]calloutNotice, time.Time, error) {
+	db, unlock, err := state.acquire(guildID)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer unlock()
+
+	now := time.Now()
+	pending := pendingCallouts(db)
+	if len(pending) == 0 {
+		return nil, now, nil
+	}
+	tournament := getCurrentTournament(db)
+	var notices []calloutNotice
+	for _, called := range pending {
+		match := findMatch(tournament, called.ID)
+		// A match is only called once, even when the channel cannot be reached
+		match.Callout = &Callout{ChannelID: db.Settings.CalloutChannel, CalledAt: now}
+		content, embed, components := calloutMessage(db, *match)
+		notices = append(notices, calloutNotice{
+			matchID:   match.ID,
+			channelID: match.Callout.ChannelID,
+			message: &discordgo.MessageSend{
+				Content:    content,
+				Embeds:     []*discordgo.MessageEmbed{embed},
+				Components: components,
+			},
+			direct: &discordgo.MessageEmbed{
+				Title:       "Your match is ready",
+				Description: fmt.Sprintf("Match %s: %s", match.ID, calloutDescription(*match)),
+				Color:       0x00FF00,
+			},
+			discordIDs: playerDiscordIDs(db, []string{match.Player1, match.Player2}),
+		})
+	}
+	if err := saveTournament(db, tournament); err != nil {
+		return nil, now, err
+	}
+	return notices, now, nil
+}
+
+// Records the messages of the call-outs sent at a time, so reminders answer them
+func saveCalloutMessages(guildID string, calledAt time.Time, messageIDs map[string]string) error {
+	db, unlock, err := state.acquire(guildID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil
+	}
+	for matchID, messageID := range messageIDs {
+		match := findMatch(tournament, matchID)
+		// The call-out may have been undone, or the match called again, while it was sent
+		if match == nil || match.Callout == nil || !match.Callout.CalledAt.Equal(calledAt) {
+			continue
+		}
+		match.Callout.MessageID = messageID
+	}
+	return saveTournament(db, tournament)
+}
+
+// Calls the matches of a server that became ready at a table: both players are
+// mentioned in the call-out channel and get a direct message
+func announceMatches(s *discordgo.Session, guildID string) {
+	// Most changes call nothing, the saved data tells without locking the server
+	if saved, err := state.snapshot(guildID); err != nil || len(pendingCallouts(saved)) == 0 {
+		return
+	}
+	notices, calledAt, err := callMatches(guildID)
+	if err != nil {
+		log.Printf("Error saving call-outs: %v", err)
+		return
+	}
+	if len(notices) == 0 {
+		return
+	}
+
+	messageIDs := make(map[string]string)
+	for _, notice := range notices {
+		if messageID := sendCalloutNotice(s, notice); messageID != "" {
+			messageIDs[notice.matchID] = messageID
+		}
+	}
+	if len(messageIDs) > 0 {
+		if err := saveCalloutMessages(guildID, calledAt, messageIDs); err != nil {
+			log.Printf("Error saving call-out messages: %v", err)
+			return
+		}
+	}
+	log.Print("Matches called successfully")
+}
+
+// Returns the players of a called match who did not check in in time
+func lateCheckIns(db *Database, match Match, now time.Time) []string {
+	if match.Callout == nil || !isMatchReady(match) {
+		return nil
+	}
+	last := match.Callout.CalledAt
+	if match.Callout.PingedAt.After(last) {
+		last = match.Callout.PingedAt
+	}
+	if now.Sub(last) < checkInTimeout(db) {
+		return nil
+	}
+	var late []string
+	for _, player := range []string{match.Player1, match.Player2} {
+		if !checkedIn(match, player) {
+			late = append(late, player)
+		}
+	}
+	return late
+}
+
+// Reports whether a player of a server has to be pinged again for their match
+func hasLateCheckIns(db *Database, now time.Time) bool {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return false
+	}
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			if len(lateCheckIns(db, match, now)) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Marks the players of a server who did not check in for their match as
+// pinged and returns their reminders
+func remindLatePlayers(guildID string, now time.Time) ([]calloutNotice, error) {
+	db, unlock, err := state.acquire(guildID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil, nil
+	}
+
+	var notices []calloutNotice
+	for r := range tournament.Rounds {
+		for m := range tournament.Rounds[r].Matches {
+			match := &tournament.Rounds[r].Matches[m]
+			late := lateCheckIns(db, *match, now)
+			if len(late) == 0 {
+				continue
+			}
+			// The next ping waits for another timeout
+			match.Callout.PingedAt = now
+			message := &discordgo.MessageSend{
+				Content: fmt.Sprintf("%s, please check in for match %s at table %s.", playerMentions(db, late), match.ID, match.TableID),
+			}
+			if match.Callout.MessageID != "" {
+				message.Reference = &discordgo.MessageReference{MessageID: match.Callout.MessageID, ChannelID: match.Callout.ChannelID}
+			}
+			notices = append(notices, calloutNotice{
+				matchID:   match.ID,
+				channelID: match.Callout.ChannelID,
+				message:   message,
+				direct: &discordgo.MessageEmbed{
+					Title:       "Check in for your match",
+					Description: fmt.Sprintf("Match %s: %s\n\nYou are expected at your table.", match.ID, calloutDescription(*match)),
+					Color:       0xFFFF00,
+				},
+				discordIDs: playerDiscordIDs(db, late),
+			})
+		}
+	}
+	if len(notices) == 0 {
+		return nil, nil
+	}
+	if err := saveTournament(db, tournament); err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+// Pings again the players of a server who did not check in for their match
+func pingLatePlayers(s *discordgo.Session, guildID string, now time.Time) {
+	// Most ticks ping nobody, the saved data tells without locking the server
+	if saved, err := state.snapshot(guildID); err != nil || !hasLateCheckIns(saved, now) {
+		return
+	}
+	notices, err := remindLatePlayers(guildID, now)
+	if err != nil {
+		log.Printf("Error saving check-in reminders: %v", err)
+		return
+	}
+	if len(notices) == 0 {
+		return
+	}
+	for _, notice := range notices {
+		sendCalloutNotice(s, notice)
+	}
+	log.Print("Late players pinged successfully")
+}
+
+// Records that a player of a called match is at their table
+func checkIn(db *Database, matchID string, player string) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+	match := findMatch(tournament, matchID)
+	if match == nil || !isMatchReady(*match) || match.Callout == nil {
+		return fmt.Errorf("this match is not being called")
+	}
+	name, ok := matchPlayerName(*match, player)
+	if !ok {
+		return fmt.Errorf("only the players of the match can check in")
+	}
+	if checkedIn(*match, name) {
+		return fmt.Errorf("%s already checked in", name)
+	}
+	match.Callout.CheckedIn = append(match.Callout.CheckedIn, name)
+	log.Print("Player checked in successfully")
+	return saveTournament(db, tournament)
+}
+
+// Handles a click on the check-in button of a call-out
+func handleCheckInButton(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, matchID string) {
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+	if err := checkIn(db, matchID, playerNameForUser(db, user)); err != nil {
+		sendEphemeralResponse(s, i, "Erreur", "Error checking in: "+err.Error(), 0xFF0000)
+		return
+	}
+	content, embed, components := calloutMessage(db, *findMatch(getCurrentTournament(db), matchID))
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error updating call-out: %v", err)
+	}
+}
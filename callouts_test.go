@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalloutMessagesSavedOnceSent(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setCallouts(db, "channel", 0)
+	unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notices, calledAt, err := callMatches("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notices) != 2 {
+		t.Fatalf("expected 2 call-outs, got %d", len(notices))
+	}
+	if again, _, err := callMatches("guild"); err != nil || len(again) != 0 {
+		t.Fatalf("matches were called twice: %d call-outs, %v", len(again), err)
+	}
+
+	// The message of an older call-out of the second match must not be kept
+	sent := map[string]string{notices[0].matchID: "first"}
+	if err := saveCalloutMessages("guild", calledAt, sent); err != nil {
+		t.Fatal(err)
+	}
+	stale := map[string]string{notices[1].matchID: "stale"}
+	if err := saveCalloutMessages("guild", calledAt.Add(-time.Minute), stale); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := state.snapshot("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tournament := getCurrentTournament(saved)
+	if messageID := findMatch(tournament, notices[0].matchID).Callout.MessageID; messageID != "first" {
+		t.Errorf("expected the call-out message first, got %q", messageID)
+	}
+	if messageID := findMatch(tournament, notices[1].matchID).Callout.MessageID; messageID != "" {
+		t.Errorf("a stale call-out message was saved: %q", messageID)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Prefix of the custom ID of match edit buttons, followed by the action and the match ID
+const editButtonPrefix = "edit"
+
+// New result of a finished match, waiting for an organizer to confirm that
+// the results of later matches will be cleared
+type MatchEdit struct {
+	Winner      string `json:"winner"`
+	Score       string `json:"score"`
+	RequestedBy string `json:"requested_by"`
+}
+
+// Returns the round a match is played in
+func matchRound(tournament *Tournament, matchID string) *Round {
+	for r := range tournament.Rounds {
+		for _, match := range tournament.Rounds[r].Matches {
+			if match.ID == matchID {
+				return &tournament.Rounds[r]
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the matches a finished match sent its players to, grand finals reset included
+func fedMatches(tournament *Tournament, match *Match) []*Match {
+	var fed []*Match
+	for _, id := range []string{match.NextmatchID, match.LoserMatchID} {
+		if next := findMatch(tournament, id); id != "" && next != nil {
+			fed = append(fed, next)
+		}
+	}
+	if match.ID == "GF1" {
+		if reset := findMatch(tournament, "GF2"); reset != nil {
+			fed = append(fed, reset)
+		}
+	}
+	return fed
+}
+
+// Returns the matches already played that depend on the result of a match: the
+// matches its players went on to, and the matches those went on to, byes skipped
+func dependentResults(tournament *Tournament, match *Match) []Match {
+	var dependents []Match
+	seen := make(map[string]bool)
+	var walk func(match *Match)
+	walk = func(match *Match) {
+		for _, fed := range fedMatches(tournament, match) {
+			if fed.Winner == "" || seen[fed.ID] {
+				continue
+			}
+			seen[fed.ID] = true
+			if !fed.Bye {
+				dependents = append(dependents, *fed)
+			}
+			walk(fed)
+		}
+	}
+	walk(match)
+	return dependents
+}
+
+// Takes back the player a match sent to a slot of another match, along with the
+// byes they went through. The other match must have no result.
+func removePlacedPlayer(tournament *Tournament, matchID string, slot int) {
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return
+	}
+	if match.Bye {
+		unadvanceMatch(tournament, match)
+		match.Player1 = ""
+		match.Winner = ""
+		return
+	}
+	if slot == 1 {
+		match.Player1 = ""
+	} else {
+		match.Player2 = ""
+	}
+	// The set is not played by the same players anymore
+	releaseTable(tournament, match)
+	match.TableID = ""
+	match.Games = nil
+	match.StageSelection = nil
+	match.Report = nil
+	match.Callout = nil
+}
+
+// Takes back the players a finished match sent on, the reverse of advanceMatch
+func unadvanceMatch(tournament *Tournament, match *Match) {
+	if match.NextmatchID != "" {
+		removePlacedPlayer(tournament, match.NextmatchID, match.NextMatchSlot)
+	}
+	if match.LoserMatchID != "" {
+		removePlacedPlayer(tournament, match.LoserMatchID, match.LoserMatchSlot)
+	}
+	if match.ID == "GF1" {
+		for r := range tournament.Rounds {
+			if tournament.Rounds[r].ID == "GFR" {
+				tournament.Rounds = append(tournament.Rounds[:r], tournament.Rounds[r+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Clears the results of the matches that depend on the result of a match,
+// the latest first, and takes their players back
+func resetDependents(tournament *Tournament, match *Match) {
+	for _, fed := range fedMatches(tournament, match) {
+		if fed.Winner == "" {
+			continue
+		}
+		if fed.Bye {
+			resetDependents(tournament, fed)
+			continue
+		}
+		resetDependents(tournament, fed)
+		unadvanceMatch(tournament, fed)
+		fed.Winner = ""
+		fed.Player1Score, fed.Player2Score = 0, 0
+		fed.Games = nil
+	}
+}
+
+// Checks a new result for a finished match and returns the match with the games
+// each player won
+func checkCorrection(tournament *Tournament, matchID string, winnerName string, score string) (*Match, int, int, error) {
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return nil, 0, 0, fmt.Errorf("match not found")
+	}
+	if match.Winner == "" {
+		return nil, 0, 0, fmt.Errorf("this match has no result to correct yet")
+	}
+	if match.Bye {
+		return nil, 0, 0, fmt.Errorf("a bye has no result to correct")
+	}
+	if match.Player1 != winnerName && match.Player2 != winnerName {
+		return nil, 0, 0, fmt.Errorf("the winner must be one of the players in the match: %s ou %s", match.Player1, match.Player2)
+	}
+	if matchRound(tournament, matchID).Phase != tournament.CurrentPhase {
+		return nil, 0, 0, fmt.Errorf("the next phase was already seeded from this result")
+	}
+	player1Games, player2Games, err := correctedScore(*match, winnerName, score)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return match, player1Games, player2Games, nil
+}
+
+// Returns the matches whose result a new result for a finished match would
+// clear. Only a new winner changes who plays the following matches.
+func invalidatedMatches(tournament *Tournament, match *Match, winnerName string) []Match {
+	if winnerName == match.Winner {
+		return nil
+	}
+	return dependentResults(tournament, match)
+}
+
+// Checks a new result for a finished match. When it would clear the results of
+// later matches, the edit is kept on the match until an organizer confirms it
+// and the matches are returned; otherwise nothing is kept.
+func requestMatchEdit(db *Database, matchID string, winnerName string, score string, requestedBy string) ([]Match, error) {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil, fmt.Errorf("no active tournament")
+	}
+	match, _, _, err := checkCorrection(tournament, matchID, winnerName, score)
+	if err != nil {
+		return nil, err
+	}
+	invalidated := invalidatedMatches(tournament, match, winnerName)
+	if len(invalidated) == 0 {
+		return nil, nil
+	}
+	match.Edit = &MatchEdit{Winner: winnerName, Score: score, RequestedBy: requestedBy}
+	log.Print("Match edit requested successfully")
+	return invalidated, saveTournament(db, tournament)
+}
+
+// Drops the edit waiting for confirmation on a match
+func cancelMatchEdit(db *Database, matchID string) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+	match := findMatch(tournament, matchID)
+	if match == nil || match.Edit == nil {
+		return fmt.Errorf("no edit waiting for confirmation on this match")
+	}
+	match.Edit = nil
+	log.Print("Match edit cancelled")
+	return saveTournament(db, tournament)
+}
+
+// Changes the result of a finished match. The results of the matches that
+// depended on it are cleared, and the bracket is played again from there with
+// the right players. Returns the matches whose result was cleared.
+func correctMatchResult(db *Database, matchID string, winnerName string, score string) ([]Match, error) {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil, fmt.Errorf("no active tournament")
+	}
+	match, player1Games, player2Games, err := checkCorrection(tournament, matchID, winnerName, score)
+	if err != nil {
+		return nil, err
+	}
+	invalidated := invalidatedMatches(tournament, match, winnerName)
+
+	recordEvent(db, EventMatchCorrected, strings.TrimSpace(fmt.Sprintf("Match %s corrected: won by %s %s", match.ID, winnerName, score)))
+	match.Edit = nil
+	// Games of the set only stay when they agree with the new result
+	if player1Wins, player2Wins := gameWins(*match); player1Wins != player1Games || player2Wins != player2Games {
+		match.Games = nil
+	}
+	if winnerName == match.Winner {
+		match.Player1Score, match.Player2Score = player1Games, player2Games
+		log.Print("Match score corrected successfully")
+		return nil, saveTournament(db, tournament)
+	}
+
+	resetDependents(tournament, match)
+	unadvanceMatch(tournament, match)
+	match.Winner = ""
+	// The phase and the tournament may be over, they go on again until the bracket is replayed
+	tournament.Phases[tournament.CurrentPhase].Status = TournamentStatusOngoing
+	tournament.Status = TournamentStatusOngoing
+	completeMatch(tournament, match, winnerName, player1Games, player2Games)
+	log.Print("Match result corrected successfully")
+	return invalidated, saveTournament(db, tournament)
+}
+
+// Returns the players involved in an edited match and in the matches it cleared
+func affectedPlayers(match Match, invalidated []Match) []string {
+	var players []string
+	seen := make(map[string]bool)
+	for _, m := range append([]Match{match}, invalidated...) {
+		for _, player := range []string{m.Player1, m.Player2} {
+			if player != "" && !seen[player] {
+				seen[player] = true
+				players = append(players, player)
+			}
+		}
+	}
+	return players
+}
+
+// Returns a mention of each player linked to a Discord account, and the name of the others
+func playerMentions(db *Database, players []string) string {
+	var mentions []string
+	for _, name := range players {
+		mention := name
+		for _, p := range db.Players {
+			if p.Username == name && p.DiscordID != "" {
+				mention = fmt.Sprintf("<@%s>", p.DiscordID)
+			}
+		}
+		mentions = append(mentions, mention)
+	}
+	return strings.Join(mentions, " ")
+}
+
+// Formats the matches whose result an edit clears
+func formatInvalidated(invalidated []Match) string {
+	var result string
+	for _, match := range invalidated {
+		result += fmt.Sprintf("- %s: %s vs %s, won by %s\n", match.ID, match.Player1, match.Player2, match.Winner)
+	}
+	return result
+}
+
+// Returns the games each player won for the new result of a finished match.
+// Without a score, the games recorded for the set are kept when the winner won enough of them.
+func correctedScore(match Match, winnerName string, score string) (int, int, error) {
+	if score == "" {
+		player1Wins, player2Wins := gameWins(match)
+		winnerWins := player1Wins
+		if winnerName == match.Player2 {
+			winnerWins = player2Wins
+		}
+		if len(match.Games) > 0 && winnerWins == gamesToWin(match) {
+			return player1Wins, player2Wins, nil
+		}
+		return 0, 0, nil
+	}
+
+	winnerGames, loserGames, err := parseScore(score)
+	if err != nil {
+		return 0, 0, err
+	}
+	// The games recorded before may be the mistake being corrected
+	match.Games = nil
+	if err := checkScore(match, winnerName, winnerGames, loserGames); err != nil {
+		return 0, 0, err
+	}
+	if winnerName == match.Player2 {
+		return loserGames, winnerGames, nil
+	}
+	return winnerGames, loserGames, nil
+}
+
+// Sends the matches an edit would clear with the buttons to confirm or cancel it
+func sendMatchEditConfirmation(s *discordgo.Session, i *discordgo.InteractionCreate, match Match, invalidated []Match) {
+	edit := match.Edit
+	description := fmt.Sprintf("Match %s: %s vs %s\nChanging the winner from %s to **%s** clears the results of:\n%s\nThese matches will be played again with the right players.",
+		match.ID, match.Player1, match.Player2, match.Winner, edit.Winner, formatInvalidated(invalidated))
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Confirm match edit",
+					Description: description,
+					Color:       0xFFFF00,
+				},
+			},
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Confirm",
+							Style:    discordgo.DangerButton,
+							CustomID: fmt.Sprintf("%s:confirm:%s", editButtonPrefix, match.ID),
+						},
+						discordgo.Button{
+							Label:    "Cancel",
+							Style:    discordgo.SecondaryButton,
+							CustomID: fmt.Sprintf("%s:cancel:%s", editButtonPrefix, match.ID),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending match edit: %v", err)
+	}
+}
+
+// Handles a click on the confirm or cancel button of a match edit. Affected
+// players are mentioned so they know their matches changed.
+func handleEditButton(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, action string, matchID string) {
+	if memberLevel(db, i) < LevelOrganizer {
+		sendEphemeralResponse(s, i, "Erreur", "You are not allowed to edit match results", 0xFF0000)
+		return
+	}
+
+	var content, description string
+	color := 0x00FF00
+	switch action {
+	case "confirm":
+		tournament := getCurrentTournament(db)
+		var match *Match
+		if tournament != nil {
+			match = findMatch(tournament, matchID)
+		}
+		if match == nil || match.Edit == nil {
+			sendEphemeralResponse(s, i, "Erreur", "No edit waiting for confirmation on this match", 0xFF0000)
+			return
+		}
+		before := *match
+		invalidated, err := correctMatchResult(db, matchID, match.Edit.Winner, match.Edit.Score)
+		if err != nil {
+			sendEphemeralResponse(s, i, "Erreur", "Error editing match: "+err.Error(), 0xFF0000)
+			return
+		}
+		edited := *findMatch(getCurrentTournament(db), matchID)
+		description = fmt.Sprintf("Match %s is now won by **%s**.\n", matchID, edited.Winner)
+		if len(invalidated) > 0 {
+			description += "Results cleared:\n" + formatInvalidated(invalidated)
+		}
+		description += "\n" + getTournamentStatus(*db)
+		content = playerMentions(db, affectedPlayers(before, invalidated)) + ", the bracket changed after an organizer edited a result."
+	case "cancel":
+		if err := cancelMatchEdit(db, matchID); err != nil {
+			sendEphemeralResponse(s, i, "Erreur", err.Error(), 0xFF0000)
+			return
+		}
+		description = fmt.Sprintf("Edit of match %s cancelled.", matchID)
+		color = 0xFF0000
+	default:
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Match edit",
+					Description: description,
+					Color:       color,
+				},
+			},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Printf("Error updating match edit: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Number of latest events that keep the data as it was before them, so they can be undone
+const undoDepth = 20
+
+type EventType string
+
+const (
+	EventPlayerAdded        EventType = "player_added"
+	EventPlayerLinked       EventType = "player_linked"
+	EventPlayerRemoved      EventType = "player_removed"
+	EventPlayerSeeded       EventType = "player_seeded"
+	EventPlayersCleared     EventType = "players_cleared"
+	EventTablesAdded        EventType = "tables_added"
+	EventTablesRemoved      EventType = "tables_removed"
+	EventTablesCleared      EventType = "tables_cleared"
+	EventTournamentStarted  EventType = "tournament_started"
+	EventTournamentCleared  EventType = "tournament_cleared"
+	EventRoundAdvanced      EventType = "round_advanced"
+	EventBestOfSet          EventType = "best_of_set"
+	EventRulesetSet         EventType = "ruleset_set"
+	EventGameRecorded       EventType = "game_recorded"
+	EventMatchReported      EventType = "match_reported"
+	EventMatchCorrected     EventType = "match_corrected"
+	EventReportSubmitted    EventType = "report_submitted"
+	EventReportDisputed     EventType = "report_disputed"
+	EventDatabaseCleared    EventType = "database_cleared"
+	EventRegistrationOpened EventType = "registration_opened"
+	EventRegistrationClosed EventType = "registration_closed"
+	EventEntrantJoined      EventType = "entrant_joined"
+	EventEntrantLeft        EventType = "entrant_left"
+	EventUndone             EventType = "undone"
+)
+
+// Entry of the append-only log of changes made to the data of a server
+type Event struct {
+	ID          int       `json:"id"`
+	Type        EventType `json:"type"`
+	Actor       string    `json:"actor,omitempty"`
+	Description string    `json:"description"`
+	Time        time.Time `json:"time"`
+	// Data the change touched as it was before it, only kept for the latest events
+	Before json.RawMessage `json:"before,omitempty"`
+	// ID of the event reverted by an undo
+	Undid int `json:"undid,omitempty"`
+}
+
+// Part of the data of a server an event changes
+type EventScope string
+
+const (
+	// Players, tables and tournaments, as kept by every event before scopes
+	ScopeAll        EventScope = ""
+	ScopePlayers    EventScope = "players"
+	ScopeTables     EventScope = "tables"
+	ScopeTournament EventScope = "tournament"
+)
+
+// Returns the part of the data of a server an event changes. Tournament events
+// only change the current tournament, or add the one they start.
+func eventScope(eventType EventType) EventScope {
+	switch eventType {
+	case EventPlayerAdded, EventPlayerLinked, EventPlayerRemoved, EventPlayerSeeded, EventPlayersCleared:
+		return ScopePlayers
+	case EventTablesAdded, EventTablesRemoved, EventTablesCleared:
+		return ScopeTables
+	case EventTournamentCleared, EventDatabaseCleared:
+		return ScopeAll
+	}
+	return ScopeTournament
+}
+
+// Data restored by undoing an event, limited to its scope
+type History struct {
+	Scope       EventScope   `json:"scope,omitempty"`
+	Players     []Player     `json:"players,omitempty"`
+	Tables      []Table      `json:"tables,omitempty"`
+	Tournaments []Tournament `json:"tournaments,omitempty"`
+	// Number of tournaments before a tournament event, the last of which is kept
+	TournamentCount int `json:"tournament_count,omitempty"`
+}
+
+// Returns the data an event of a scope is about to change
+func eventHistory(db *Database, scope EventScope) History {
+	switch scope {
+	case ScopePlayers:
+		return History{Scope: scope, Players: db.Players}
+	case ScopeTables:
+		return History{Scope: scope, Tables: db.Tables}
+	case ScopeTournament:
+		history := History{Scope: scope, TournamentCount: len(db.Tournaments)}
+		if current := getCurrentTournament(db); current != nil {
+			history.Tournaments = []Tournament{*current}
+		}
+		return history
+	}
+	return History{Players: db.Players, Tables: db.Tables, Tournaments: db.Tournaments}
+}
+
+// Adds an event to the log of a server, with the data it changes as it is
+// before the change. It is saved along with the change, so it must be called
+// once the change is known to be valid and before it is applied.
+func recordEvent(db *Database, eventType EventType, description string) *Event {
+	var before json.RawMessage
+	// Undos are never undone, they do not keep any data
+	if eventType != EventUndone {
+		var err error
+		before, err = json.Marshal(eventHistory(db, eventScope(eventType)))
+		if err != nil {
+			log.Printf("Error saving history: %v", err)
+			before = nil
+		}
+	}
+	db.Events = append(db.Events, Event{
+		ID:          len(db.Events) + 1,
+		Type:        eventType,
+		Actor:       db.actor,
+		Description: description,
+		Time:        time.Now(),
+		Before:      before,
+	})
+	trimEventHistory(db.Events)
+	return &db.Events[len(db.Events)-1]
+}
+
+// Drops the data kept by events too old to be undone
+func trimEventHistory(events []Event) {
+	for e := 0; e < len(events)-undoDepth; e++ {
+		events[e].Before = nil
+	}
+}
+
+// Returns the events recorded since the data of a server was loaded or saved
+func unsavedEvents(db *Database) []Event {
+	return db.Events[db.savedEvents:]
+}
+
+// Returns the latest event that can still be reverted: undos are skipped, and
+// so are the events they reverted
+func lastUndoableEvent(db *Database) *Event {
+	undone := make(map[int]bool)
+	for e := len(db.Events) - 1; e >= 0; e-- {
+		event := &db.Events[e]
+		if event.Type == EventUndone {
+			undone[event.Undid] = true
+			continue
+		}
+		if !undone[event.ID] {
+			return event
+		}
+	}
+	return nil
+}
+
+// Reverts the latest change to players, tables and tournaments. Undoing again
+// reverts the change before it.
+func undoLastEvent(db *Database) (Event, error) {
+	event := lastUndoableEvent(db)
+	if event == nil {
+		return Event{}, fmt.Errorf("nothing to undo")
+	}
+	if event.Before == nil {
+		return Event{}, fmt.Errorf("%q is too old to be undone", event.Description)
+	}
+	var before History
+	if err := json.Unmarshal(event.Before, &before); err != nil {
+		return Event{}, fmt.Errorf("error reading history: %w", err)
+	}
+	undone := *event
+
+	players := append([]Player{}, before.Players...)
+	tables := append([]Table{}, before.Tables...)
+	tournaments := append([]Tournament{}, before.Tournaments...)
+	switch before.Scope {
+	case ScopePlayers:
+		tables, tournaments = db.Tables, db.Tournaments
+	case ScopeTables:
+		players, tournaments = db.Players, db.Tournaments
+	case ScopeTournament:
+		// The tournaments before the current one did not change
+		kept := before.TournamentCount - len(before.Tournaments)
+		if kept < 0 || kept > len(db.Tournaments) {
+			return Event{}, fmt.Errorf("the tournaments changed since %q, it cannot be undone", undone.Description)
+		}
+		players, tables = db.Players, db.Tables
+		tournaments = append(append([]Tournament{}, db.Tournaments[:kept]...), before.Tournaments...)
+	}
+
+	recordEvent(db, EventUndone, "Undo: "+undone.Description).Undid = undone.ID
+	keepDiscordState(db.Tournaments, tournaments)
+	db.Players = players
+	db.Tables = tables
+	db.Tournaments = tournaments
+	log.Print("Event undone successfully")
+	return undone, saveDatabase(*db)
+}
+
+// Gives restored tournaments the threads, call-outs and sign-up messages that
+// exist on Discord now, which undo can't bring back or take away. Matches that
+// are gone now lost their thread and call-out, new ones are sent if needed.
+func keepDiscordState(current []Tournament, restored []Tournament) {
+	matches := make(map[string]Match)
+	registrations := make(map[string]*Registration)
+	for _, tournament := range current {
+		for _, round := range tournament.Rounds {
+			for _, match := range round.Matches {
+				matches[tournament.ID+"/"+match.ID] = match
+			}
+		}
+		registrations[tournament.ID] = tournament.Registration
+	}
+
+	for t := range restored {
+		tournament := &restored[t]
+		for r := range tournament.Rounds {
+			for m := range tournament.Rounds[r].Matches {
+				match := &tournament.Rounds[r].Matches[m]
+				now := matches[tournament.ID+"/"+match.ID]
+				match.ThreadID = now.ThreadID
+				match.ThreadArchived = now.ThreadArchived
+				match.Callout = now.Callout
+			}
+		}
+		if registration := registrations[tournament.ID]; tournament.Registration != nil && registration != nil {
+			tournament.Registration.ChannelID = registration.ChannelID
+			tournament.Registration.MessageID = registration.MessageID
+		}
+	}
+}
+
+// Formats the latest events of a server, newest first
+func formatHistory(db *Database, count int) string {
+	if len(db.Events) == 0 {
+		return "No action recorded yet."
+	}
+	undone := make(map[int]bool)
+	for _, event := range db.Events {
+		if event.Type == EventUndone {
+			undone[event.Undid] = true
+		}
+	}
+	var result string
+	for e := len(db.Events) - 1; e >= 0 && e >= len(db.Events)-count; e-- {
+		event := db.Events[e]
+		result += fmt.Sprintf("#%d %s - %s", event.ID, event.Time.Format("Jan 2 15:04"), event.Description)
+		if event.Actor != "" {
+			result += " (" + event.Actor + ")"
+		}
+		if undone[event.ID] {
+			result += " *undone*"
+		}
+		result += "\n"
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUndoKeepsDiscordState(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	tournament := getCurrentTournament(db)
+	match := &tournament.Rounds[0].Matches[0]
+	matchID, winner := match.ID, match.Player1
+	if err := updateMatchResult(db, matchID, winner, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The thread and call-out were sent after the result was recorded
+	played := findMatch(getCurrentTournament(db), matchID)
+	played.ThreadID = "thread"
+	played.ThreadArchived = true
+	played.Callout = &Callout{ChannelID: "channel", CalledAt: time.Now(), PingedAt: time.Now()}
+	if err := saveTournament(db, getCurrentTournament(db)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := undoLastEvent(db); err != nil {
+		t.Fatal(err)
+	}
+	restored := findMatch(getCurrentTournament(db), matchID)
+	if restored.Winner != "" {
+		t.Fatalf("the result of %s was not undone", matchID)
+	}
+	if restored.ThreadID != "thread" || !restored.ThreadArchived {
+		t.Errorf("the archived thread was lost, got %q archived %v", restored.ThreadID, restored.ThreadArchived)
+	}
+	if restored.Callout == nil || restored.Callout.PingedAt.IsZero() {
+		t.Error("the call-out was lost, the match would be called again")
+	}
+
+	// Clearing deletes the threads, undoing it must not point at them again
+	if err := clearTournament(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := undoLastEvent(db); err != nil {
+		t.Fatal(err)
+	}
+	restored = findMatch(getCurrentTournament(db), matchID)
+	if restored == nil {
+		t.Fatal("the tournament was not restored")
+	}
+	if restored.ThreadID != "" || restored.Callout != nil {
+		t.Errorf("the match points at the thread %q of a cleared tournament", restored.ThreadID)
+	}
+}
+
+// Returns the data kept by an event to undo it
+func eventBefore(t *testing.T, event Event) History {
+	t.Helper()
+	var before History
+	if err := json.Unmarshal(event.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	return before
+}
+
+func TestEventsKeepWhatTheyChange(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	match := getCurrentTournament(db).Rounds[0].Matches[0]
+	if err := updateMatchResult(db, match.ID, match.Player1, ""); err != nil {
+		t.Fatal(err)
+	}
+	before := eventBefore(t, db.Events[len(db.Events)-1])
+	if before.Scope != ScopeTournament || len(before.Tournaments) != 1 || len(before.Players) != 0 || len(before.Tables) != 0 {
+		t.Fatalf("the result kept %d players, %d tables and %d tournaments", len(before.Players), len(before.Tables), len(before.Tournaments))
+	}
+
+	if err := addPlayer(db, Player{ID: "5", Username: "player05"}); err != nil {
+		t.Fatal(err)
+	}
+	before = eventBefore(t, db.Events[len(db.Events)-1])
+	if before.Scope != ScopePlayers || len(before.Players) != 4 || len(before.Tournaments) != 0 {
+		t.Fatalf("adding a player kept %d players and %d tournaments", len(before.Players), len(before.Tournaments))
+	}
+
+	// Undoing each change leaves the others as they are
+	if _, err := undoLastEvent(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Players) != 4 || findMatch(getCurrentTournament(db), match.ID).Winner == "" {
+		t.Fatalf("undoing the new player changed the tournament or kept %d players", len(db.Players))
+	}
+	if _, err := undoLastEvent(db); err != nil {
+		t.Fatal(err)
+	}
+	if findMatch(getCurrentTournament(db), match.ID).Winner != "" {
+		t.Fatal("the result was not undone")
+	}
+	if _, err := undoLastEvent(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Tournaments) != 0 || len(db.Players) != 4 || len(db.Tables) != 2 {
+		t.Fatalf("undoing the start left %d tournaments, %d players and %d tables", len(db.Tournaments), len(db.Players), len(db.Tables))
+	}
+}
+
+func TestEventsSavedWithTheirChange(t *testing.T) {
+	useTestStore(t)
+	for p := 1; p <= 2; p++ {
+		db, unlock, err := state.acquire("guild")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = addPlayer(db, Player{ID: fmt.Sprint(p), Username: fmt.Sprintf("player%02d", p)})
+		unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The second change wrote the file once, keeping a single snapshot
+	if _, err := os.Stat("database.json.2"); !os.IsNotExist(err) {
+		t.Errorf("the second change was written more than once: %v", err)
+	}
+	saved, err := dataStore.Load("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Players) != 2 || len(saved.Events) != 2 {
+		t.Errorf("expected 2 players and 2 events, got %d and %d", len(saved.Players), len(saved.Events))
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Returns the number of games a set of a round is played in: the round's
+// override when there is one, else best of 5 from top 8 onwards and best of 3
+// before that and in pools
+func defaultBestOf(tournament *Tournament, round Round) int {
+	if bestOf, ok := tournament.RoundBestOf[round.ID]; ok {
+		return bestOf
+	}
+
+	switch round.Bracket {
+	case BracketPools, BracketSwiss:
+		return 3
+	case BracketGrandFinals:
+		return 5
+	}
+
+	// The first winners round keeps every match, byes included, so it gives the bracket size
+	size := 0
+	for _, r := range tournament.Rounds {
+		if r.Phase == round.Phase && r.Bracket == BracketWinners && r.Number == 1 {
+			size = 2 * len(r.Matches)
+		}
+	}
+
+	// In double elimination, top 8 is the last 4 players of each side
+	remaining := size >> (round.Number - 1)
+	topCut := 8
+	if tournament.Phases[round.Phase].Format == FormatDoubleElimination {
+		topCut = 4
+	}
+	if round.Bracket == BracketLosers {
+		remaining = size >> (1 + (round.Number-1)/2)
+	}
+	if remaining <= topCut {
+		return 5
+	}
+	return 3
+}
+
+// Sets the best-of of matches that do not have one yet
+func applyBestOf(tournament *Tournament) {
+	for r := range tournament.Rounds {
+		for m := range tournament.Rounds[r].Matches {
+			match := &tournament.Rounds[r].Matches[m]
+			if match.BestOf == 0 && !match.Bye {
+				match.BestOf = defaultBestOf(tournament, tournament.Rounds[r])
+			}
+		}
+	}
+}
+
+// Changes the best-of of a round, matches already started keep their setting
+func setRoundBestOf(db *Database, roundID string, bestOf int) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+	if bestOf < 1 || bestOf%2 == 0 {
+		return fmt.Errorf("a set must be played in an odd number of games")
+	}
+
+	recordEvent(db, EventBestOfSet, fmt.Sprintf("Round %s set to best of %d", roundID, bestOf))
+	if tournament.RoundBestOf == nil {
+		tournament.RoundBestOf = make(map[string]int)
+	}
+	tournament.RoundBestOf[roundID] = bestOf
+
+	for r := range tournament.Rounds {
+		if tournament.Rounds[r].ID != roundID {
+			continue
+		}
+		for m := range tournament.Rounds[r].Matches {
+			match := &tournament.Rounds[r].Matches[m]
+			if match.Winner == "" && len(match.Games) == 0 && !match.Bye {
+				match.BestOf = bestOf
+			}
+		}
+	}
+	log.Print("Round best-of updated successfully")
+	return saveTournament(db, tournament)
+}
+
+// Returns the number of games each player of a match has won
+func gameWins(match Match) (int, int) {
+	var player1Wins, player2Wins int
+	for _, game := range match.Games {
+		if game.Winner == match.Player1 {
+			player1Wins++
+		} else {
+			player2Wins++
+		}
+	}
+	return player1Wins, player2Wins
+}
+
+// Returns the number of games needed to win a set
+func gamesToWin(match Match) int {
+	return match.BestOf/2 + 1
+}
+
+// Records a game of a set and records the set once a player has won enough games
+func recordGame(db *Database, matchID string, game Game) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return fmt.Errorf("match not found")
+	}
+	if !isMatchReady(*match) {
+		return fmt.Errorf("this match is not being played")
+	}
+	if game.Winner != match.Player1 && game.Winner != match.Player2 {
+		return fmt.Errorf("the winner must be one of the players in the match: %s ou %s", match.Player1, match.Player2)
+	}
+	if err := checkGameDetails(tournamentGame(tournament), &game); err != nil {
+		return err
+	}
+
+	// The stage chosen by striking or counterpicking is used when none is given
+	if game.Stage == "" && match.StageSelection != nil {
+		game.Stage = match.StageSelection.Stage
+	}
+	recordEvent(db, EventGameRecorded, fmt.Sprintf("Match %s: game %d won by %s", match.ID, len(match.Games)+1, game.Winner))
+	match.StageSelection = nil
+
+	match.Games = append(match.Games, game)
+	player1Wins, player2Wins := gameWins(*match)
+	if player1Wins == gamesToWin(*match) || player2Wins == gamesToWin(*match) {
+		completeMatch(tournament, match, game.Winner, player1Wins, player2Wins)
+	} else {
+		newStageSelection(tournament, match)
+	}
+	log.Print("Game recorded successfully")
+	return saveTournament(db, tournament)
+}
+
+// Checks the characters, stage and stocks of a game against the game's roster
+// and stage list, and replaces typed names with their roster spelling
+func checkGameDetails(title GameTitle, game *Game) error {
+	var err error
+	if game.WinnerCharacter != "" {
+		if game.WinnerCharacter, err = findCharacter(title, game.WinnerCharacter); err != nil {
+			return err
+		}
+	}
+	if game.LoserCharacter != "" {
+		if game.LoserCharacter, err = findCharacter(title, game.LoserCharacter); err != nil {
+			return err
+		}
+	}
+	if game.Stage != "" {
+		if game.Stage, err = findStage(title, game.Stage); err != nil {
+			return err
+		}
+	}
+	// No stocks is a game recorded without them
+	if game.Stocks != 0 && (game.Stocks < 1 || game.Stocks > stockCounts[title]) {
+		return fmt.Errorf("the winner can have between 1 and %d stocks left", stockCounts[title])
+	}
+	return nil
+}
+
+// Checks a set score against the best-of of a match and the games already recorded
+func checkScore(match Match, winnerName string, winnerGames, loserGames int) error {
+	if match.BestOf == 0 {
+		return nil
+	}
+	if winnerGames != gamesToWin(match) {
+		return fmt.Errorf("this set is a best of %d, the winner needs %d games", match.BestOf, gamesToWin(match))
+	}
+	if len(match.Games) == 0 {
+		return nil
+	}
+	player1Wins, player2Wins := gameWins(match)
+	if winnerName == match.Player2 {
+		player1Wins, player2Wins = player2Wins, player1Wins
+	}
+	if player1Wins > winnerGames || player2Wins > loserGames {
+		return fmt.Errorf("the score does not match the %d games already recorded", len(match.Games))
+	}
+	return nil
+}
+
+// Formats the score of a finished set from the winner's side, e.g. "2-1"
+func formatScore(match Match) string {
+	if match.Player1Score == 0 && match.Player2Score == 0 {
+		return ""
+	}
+	if match.Winner == match.Player2 {
+		return fmt.Sprintf("%d-%d", match.Player2Score, match.Player1Score)
+	}
+	return fmt.Sprintf("%d-%d", match.Player1Score, match.Player2Score)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/uuid"
@@ -12,25 +13,43 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
-// Basic structure that stores all data
+// Basic structure that stores all data of a server
 type Database struct {
+	GuildID     string       `json:"guild_id"`
 	Players     []Player     `json:"players"`
 	Tables      []Table      `json:"tables"`
-	Tournaments []Tournament `json:"tournament"`
+	Tournaments []Tournament `json:"tournaments"`
+	Settings    Settings     `json:"settings"`
+	Events      []Event      `json:"events,omitempty"`
+
+	// Discord user running the current command, recorded in events
+	actor string
+	// Number of events already in the store
+	savedEvents int
 }
 
 type Round struct {
-	Matches []Match `json:"matches"`
+	ID      string      `json:"id"`
+	Phase   int         `json:"phase"`
+	Number  int         `json:"number"`
+	Bracket BracketSide `json:"bracket"`
+	Matches []Match     `json:"matches"`
 }
 
 type Player struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Seed      int    `json:"seed"`
+	Rating    int    `json:"rating"`
+	DiscordID string `json:"discord_id,omitempty"`
 }
 
 type Table struct {
@@ -48,58 +67,131 @@ type Tournament struct {
 	CurrentRound int              `json:"current_round"`
 	IsFirstRound bool             `json:"is_first_round"`
 	Tables       []Table          `json:"tables"`
+	Phases       []Phase          `json:"phases"`
+	CurrentPhase int              `json:"current_phase"`
+	RoundBestOf  map[string]int   `json:"round_best_of"`
+	Game         GameTitle        `json:"game"`
+	Ruleset      Ruleset          `json:"ruleset"`
+	Registration *Registration    `json:"registration,omitempty"`
+}
+
+// A stage of a tournament played with a single format, e.g. pools then a bracket
+type Phase struct {
+	Name        string           `json:"name"`
+	Format      TournamentFormat `json:"format"`
+	Pools       [][]string       `json:"pools"`
+	Advance     int              `json:"advance"`
+	SwissRounds int              `json:"swiss_rounds"`
+	Status      TournamentStatus `json:"status"`
+}
+
+// Settings chosen when starting a tournament. When Advance is set, the top
+// Advance players of each pool move on to a BracketFormat bracket.
+type TournamentOptions struct {
+	Format        TournamentFormat
+	Pools         int
+	SwissRounds   int
+	Advance       int
+	BracketFormat TournamentFormat
+	Game          GameTitle
 }
 
 type Match struct {
-	ID              string   `json:"id"`
-	Players         []string `json:"players"`
-	Player1         string   `json:"player1"`
-	Player2         string   `json:"player2"`
-	Winner          string   `json:"winner"`
-	TableID         string   `json:"table_id"`
-	Classe          string   `json:"classe"`
-	NextmatchID     string   `json:"next_match_id"`
-	WaitingForMatch string   `json:"waiting_for_match"`
+	ID              string          `json:"id"`
+	Players         []string        `json:"players"`
+	Player1         string          `json:"player1"`
+	Player2         string          `json:"player2"`
+	Winner          string          `json:"winner"`
+	Player1Score    int             `json:"player1_score"`
+	Player2Score    int             `json:"player2_score"`
+	TableID         string          `json:"table_id"`
+	Bracket         BracketSide     `json:"bracket"`
+	NextmatchID     string          `json:"next_match_id"`
+	NextMatchSlot   int             `json:"next_match_slot"`
+	LoserMatchID    string          `json:"loser_match_id"`
+	LoserMatchSlot  int             `json:"loser_match_slot"`
+	Bye             bool            `json:"bye"`
+	Pool            int             `json:"pool"`
+	WaitingForMatch string          `json:"waiting_for_match"`
+	BestOf          int             `json:"best_of"`
+	Games           []Game          `json:"games"`
+	StageSelection  *StageSelection `json:"stage_selection,omitempty"`
+	Report          *Report         `json:"report,omitempty"`
+	Edit            *MatchEdit      `json:"edit,omitempty"`
+	Callout         *Callout        `json:"callout,omitempty"`
+	ThreadID        string          `json:"thread_id,omitempty"`
+	ThreadArchived  bool            `json:"thread_archived,omitempty"`
+}
+
+// A single game of a set. Stocks is the number of stocks the winner had left,
+// 0 when they were not recorded.
+type Game struct {
+	Winner          string `json:"winner"`
+	WinnerCharacter string `json:"winner_character"`
+	LoserCharacter  string `json:"loser_character"`
+	Stage           string `json:"stage"`
+	Stocks          int    `json:"stocks"`
 }
 
 type TournamentStatus string
 
-var securityCodes = map[string]int{
-	"tournament": 0,
-	"player":     0,
-	"tables":     0,
-	"ALL":        0,
+// Side of the bracket a match or round belongs to
+type BracketSide string
+
+type TournamentFormat string
+
+// Minutes a security code can confirm the clearing of data
+const securityCodeTimeout = 5
+
+// Code confirming the clearing of data, until it is used or expires
+type securityCode struct {
+	code    int
+	expires time.Time
 }
-var webServer *http.Server
+
+// Pending security codes, keyed by guild ID and type of data to clear. Every
+// server's clear commands use them, so they have their own lock.
+var (
+	securityCodesMu sync.Mutex
+	securityCodes   = map[string]securityCode{}
+)
 
 const (
 	TournamentStatusPending  TournamentStatus = "pending"
 	TournamentStatusOngoing  TournamentStatus = "ongoing"
 	TournamentStatusComplete TournamentStatus = "complete"
 	BOT_COMMAND_PREFIX       string           = "smashbot"
+	ADMIN_COMMAND_PREFIX     string           = "smashbot-admin"
 )
 
-// Loads or creates new database from file
-func loadDatabase() (*Database, error) {
-	file, err := os.ReadFile("database.json")
-	if err != nil {
-		if os.IsNotExist(err) {
-			log.Println("Database file does not exist. Creating a new one.")
-			return &Database{
-				Players:     []Player{},
-				Tables:      []Table{},
-				Tournaments: []Tournament{},
-			}, nil
-		}
-		log.Printf("Error reading database file: %v", err)
-		return nil, fmt.Errorf("error reading database file: %w", err)
-	}
+const (
+	BracketWinners     BracketSide = "winners"
+	BracketLosers      BracketSide = "losers"
+	BracketGrandFinals BracketSide = "grand_finals"
+	BracketPools       BracketSide = "pools"
+	BracketSwiss       BracketSide = "swiss"
+)
+
+// Key of data saved before multi-server support, until a server claims it
+const legacyGuildID = "legacy"
+
+const (
+	FormatDoubleElimination TournamentFormat = "double_elimination"
+	FormatSingleElimination TournamentFormat = "single_elimination"
+	FormatRoundRobin        TournamentFormat = "round_robin"
+	FormatSwiss             TournamentFormat = "swiss"
+)
 
-	var db Database
-	if err := json.Unmarshal(file, &db); err != nil {
-		log.Printf("Error unmarshalling database: %v", err)
-		return nil, fmt.Errorf("error unmarshalling database: %w", err)
+// Loads or creates the database of a server
+func loadDatabase(guildID string) (*Database, error) {
+	if guildID == "" {
+		return nil, fmt.Errorf("this bot can only be used in a server")
+	}
+	db, err := dataStore.Load(guildID)
+	if err != nil {
+		return nil, err
 	}
+	db.GuildID = guildID
 	if db.Players == nil {
 		db.Players = []Player{}
 	}
@@ -109,26 +201,67 @@ func loadDatabase() (*Database, error) {
 	if db.Tournaments == nil {
 		db.Tournaments = []Tournament{}
 	}
+	db.savedEvents = len(db.Events)
 	log.Println("Database loaded successfully")
-	return &db, nil
+	return db, nil
 }
 
-// Saves current database state to file
-func saveDatabase(db Database) error {
-	file, err := json.MarshalIndent(db, "", "  ")
-	if err != nil {
-		log.Printf("Error marshalling database: %v", err)
-		return fmt.Errorf("error marshalling database: %w", err)
+// Gives the data saved before multi-server support to a server without data of its own
+func claimLegacyData(db *Database) error {
+	if err := dataStore.ClaimLegacy(db.GuildID); err != nil {
+		return err
 	}
-	err = os.WriteFile("database.json", file, 0644)
+	claimed, err := loadDatabase(db.GuildID)
 	if err != nil {
-		log.Printf("Error writing database file: %v", err)
-		return fmt.Errorf("error writing database file: %w", err)
+		return err
+	}
+	claimed.actor = db.actor
+	*db = *claimed
+	state.publish(db)
+	log.Print("Legacy data claimed successfully")
+	return nil
+}
+
+// Saves the whole database of a server
+func saveDatabase(db Database) error {
+	if err := dataStore.Save(&db); err != nil {
+		return err
 	}
+	state.publish(&db)
 	log.Println("Database saved successfully")
 	return nil
 }
 
+// Saves the players of a server, along with the events of the change
+func savePlayers(db *Database) error {
+	return saved(db, dataStore.SavePlayers(db.GuildID, db.Players, unsavedEvents(db)))
+}
+
+// Saves the tables of a server, along with the events of the change
+func saveTables(db *Database) error {
+	return saved(db, dataStore.SaveTables(db.GuildID, db.Tables, unsavedEvents(db)))
+}
+
+// Saves a tournament of a server, along with the events of the change
+func saveTournament(db *Database, tournament *Tournament) error {
+	return saved(db, dataStore.SaveTournament(db.GuildID, *tournament, unsavedEvents(db)))
+}
+
+// Saves the settings of a server, along with the events of the change
+func saveSettings(db *Database) error {
+	return saved(db, dataStore.SaveSettings(db.GuildID, db.Settings, unsavedEvents(db)))
+}
+
+// Publishes the data of a server once a save succeeded
+func saved(db *Database, err error) error {
+	if err != nil {
+		return err
+	}
+	db.savedEvents = len(db.Events)
+	state.publish(db)
+	return nil
+}
+
 /* Player management functions */
 
 // Adds new player to database
@@ -138,19 +271,82 @@ func addPlayer(db *Database, player Player) error {
 		if p.Username == player.Username {
 			return fmt.Errorf("player already exists")
 		}
+		if player.DiscordID != "" && p.DiscordID == player.DiscordID {
+			return fmt.Errorf("this Discord account is already linked to %s", p.Username)
+		}
 	}
+	recordEvent(db, EventPlayerAdded, fmt.Sprintf("Player %s added", player.Username))
 	db.Players = append(db.Players, player)
 	log.Print("Player added successfully")
-	return saveDatabase(*db)
+	return savePlayers(db)
+}
+
+// Adds a Discord member as a player, or links them to the player with their username
+func registerPlayer(db *Database, userID string, username string) (Player, error) {
+	for _, p := range db.Players {
+		if p.DiscordID == userID {
+			return Player{}, fmt.Errorf("you are already registered as %s", p.Username)
+		}
+	}
+	for i, p := range db.Players {
+		if strings.EqualFold(p.Username, username) {
+			if p.DiscordID != "" {
+				return Player{}, fmt.Errorf("player %s is already linked to another Discord account", p.Username)
+			}
+			recordEvent(db, EventPlayerLinked, fmt.Sprintf("Player %s linked to <@%s>", p.Username, userID))
+			db.Players[i].DiscordID = userID
+			log.Print("Player linked successfully")
+			return db.Players[i], savePlayers(db)
+		}
+	}
+
+	player := Player{
+		ID:        uuid.New().String(),
+		Username:  username,
+		DiscordID: userID,
+	}
+	return player, addPlayer(db, player)
+}
+
+// Returns the player name of a Discord user: the player linked to their account,
+// else their Discord username. A player linked to another account can only be
+// played by that account, so an unlinked member named like them gets no name.
+func playerNameForUser(db *Database, user *discordgo.User) string {
+	for _, p := range db.Players {
+		if p.DiscordID != "" && p.DiscordID == user.ID {
+			return p.Username
+		}
+	}
+	for _, p := range db.Players {
+		if p.DiscordID != "" && strings.EqualFold(p.Username, user.Username) {
+			return ""
+		}
+	}
+	return user.Username
+}
+
+// Returns the winner chosen by name with the winner option or by mention with the winner_user option
+func winnerOption(db *Database, data discordgo.ApplicationCommandInteractionData, options []*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	if opt := getOption(options, "winner_user"); opt != nil {
+		user := opt.UserValue(nil)
+		if data.Resolved != nil && data.Resolved.Users[user.ID] != nil {
+			user = data.Resolved.Users[user.ID]
+		}
+		return playerNameForUser(db, user), nil
+	}
+	if opt := getOption(options, "winner"); opt != nil {
+		return opt.StringValue(), nil
+	}
+	return "", fmt.Errorf("winner or winner_user required")
 }
 
 // Removes player from database
 func removePlayer(db *Database, username string) error {
 	for i, p := range db.Players {
 		if p.Username == username {
-
+			recordEvent(db, EventPlayerRemoved, fmt.Sprintf("Player %s removed", username))
 			db.Players = append(db.Players[:i], db.Players[i+1:]...)
-			return saveDatabase(*db)
+			return savePlayers(db)
 		}
 	}
 	log.Print("Player removed successfully")
@@ -164,12 +360,61 @@ func listPlayers(db *Database) string {
 	}
 	var playersList strings.Builder
 	for i, player := range db.Players {
-		playersList.WriteString(fmt.Sprintf("%d. %s\n", i+1, player.Username))
+		playersList.WriteString(fmt.Sprintf("%d. %s", i+1, player.Username))
+		if player.Seed > 0 {
+			playersList.WriteString(fmt.Sprintf(" (Seed: %d)", player.Seed))
+		}
+		if player.Rating > 0 {
+			playersList.WriteString(fmt.Sprintf(" (Rating: %d)", player.Rating))
+		}
+		if player.DiscordID != "" {
+			playersList.WriteString(fmt.Sprintf(" <@%s>", player.DiscordID))
+		}
+		playersList.WriteString("\n")
 	}
 	log.Print("List of player sent successfully")
 	return playersList.String()
 }
 
+// Sets the seed and the rating of a player, a zero value leaves it unchanged
+func setPlayerSeed(db *Database, username string, seed int, rating int) error {
+	for i := range db.Players {
+		if db.Players[i].Username == username {
+			recordEvent(db, EventPlayerSeeded, fmt.Sprintf("Seed of %s updated", username))
+			if seed > 0 {
+				db.Players[i].Seed = seed
+			}
+			if rating > 0 {
+				db.Players[i].Rating = rating
+			}
+			log.Print("Player seed updated successfully")
+			return savePlayers(db)
+		}
+	}
+	return fmt.Errorf("player not found")
+}
+
+// Orders players by seed. Manually seeded players come first, then players
+// are ranked by rating, and players with neither are placed at random.
+func seedPlayers(players []Player) []Player {
+	seeded := make([]Player, len(players))
+	copy(seeded, players)
+	rand.Shuffle(len(seeded), func(i, j int) {
+		seeded[i], seeded[j] = seeded[j], seeded[i]
+	})
+	sort.SliceStable(seeded, func(a, b int) bool {
+		pa, pb := seeded[a], seeded[b]
+		if (pa.Seed > 0) != (pb.Seed > 0) {
+			return pa.Seed > 0
+		}
+		if pa.Seed != pb.Seed {
+			return pa.Seed < pb.Seed
+		}
+		return pa.Rating > pb.Rating
+	})
+	return seeded
+}
+
 // Lists all players in the database
 func listTables(db *Database) string {
 	if len(db.Tables) == 0 {
@@ -185,6 +430,7 @@ func listTables(db *Database) string {
 
 // Adds new table to database
 func addTable(db *Database, numTables int) error {
+	recordEvent(db, EventTablesAdded, fmt.Sprintf("%d tables added", numTables))
 	for i := 0; i < numTables; i++ {
 		newTable := Table{
 			ID:        strconv.Itoa(i),
@@ -193,7 +439,7 @@ func addTable(db *Database, numTables int) error {
 		db.Tables = append(db.Tables, newTable)
 	}
 	log.Print("Table added successfully")
-	return saveDatabase(*db)
+	return saveTables(db)
 }
 
 // Removes table from database
@@ -201,9 +447,10 @@ func removeTables(db *Database, numTables int) error {
 	if numTables > len(db.Tables) {
 		return fmt.Errorf("not enough tables to delete")
 	}
+	recordEvent(db, EventTablesRemoved, fmt.Sprintf("%d tables removed", numTables))
 	db.Tables = db.Tables[:len(db.Tables)-numTables]
 	log.Print("Table removed successfully")
-	return saveDatabase(*db)
+	return saveTables(db)
 }
 
 // Returns the current tournament
@@ -217,9 +464,15 @@ func getCurrentTournament(db *Database) *Tournament {
 
 // Updates the database with the current tournament
 
-// Starts a new tournament
-func startTournament(db *Database) error {
-	if len(db.Players) < 2 {
+// Starts a new tournament with every player, or with the entrants of the
+// tournament taking sign-ups
+func startTournament(db *Database, options TournamentOptions) error {
+	players := db.Players
+	pending := pendingTournament(db)
+	if pending != nil {
+		players = registrationPlayers(db, pending.Registration)
+	}
+	if len(players) < 2 {
 		return fmt.Errorf("not enough players to start a tournament. Minimum 2 players required")
 	}
 
@@ -228,35 +481,68 @@ func startTournament(db *Database) error {
 
 	}
 
+	phases, err := buildPhases(options, len(players))
+	if err != nil {
+		return err
+	}
+
 	tournament := Tournament{
 		ID:           strconv.Itoa(len(db.Tournaments) + 1),
 		CurrentRound: 0,
 		Status:       TournamentStatusPending,
 		Players:      make([]string, 0),
 		IsFirstRound: true,
-		Tables:       db.Tables,
+		Tables:       make([]Table, len(db.Tables)),
+		Phases:       phases,
+		Game:         options.Game,
+	}
+	if tournament.Game == "" {
+		tournament.Game = GameUltimate
+	}
+	tournament.Ruleset = defaultRuleset(tournament.Game)
+	for i, table := range db.Tables {
+		tournament.Tables[i] = Table{ID: table.ID, Available: true}
+	}
+	if pending != nil {
+		// Sign-ups end when the tournament starts, the best-ofs set meanwhile are kept
+		tournament.ID = pending.ID
+		tournament.RoundBestOf = pending.RoundBestOf
+		tournament.Registration = pending.Registration
+		tournament.Registration.Open = false
+	}
+
+	players = seedPlayers(players)
+
+	var usernames []string
+	for _, p := range players {
+		usernames = append(usernames, p.Username)
+	}
+	phase := &tournament.Phases[0]
+	switch phase.Format {
+	case FormatRoundRobin:
+		phase.Pools = splitIntoPools(usernames, options.Pools)
+		startPhase(&tournament, buildRoundRobin(phase.Pools))
+	case FormatSwiss:
+		phase.Pools = [][]string{usernames}
+		if err := startNextSwissRound(&tournament); err != nil {
+			return err
+		}
+		startPhase(&tournament, nil)
+	default:
+		startPhase(&tournament, buildEliminationBracket(firstRound(usernames), phase.Format == FormatDoubleElimination))
 	}
-
-	players := make([]Player, len(db.Players))
-	copy(players, db.Players)
-	rand.Shuffle(len(players), func(i, j int) {
-		players[i], players[j] = players[j], players[i]
-	})
-
-	firstRoundMatches := firstRound(players, db.Tables)
-
-	tournament.Rounds = append(tournament.Rounds, Round{
-		Matches: firstRoundMatches,
-	})
 	tournament.Status = TournamentStatusOngoing
 
-	for _, p := range db.Players {
-		tournament.Players = append(tournament.Players, p.Username)
-	}
+	tournament.Players = usernames
 
-	db.Tournaments = append(db.Tournaments, tournament)
+	recordEvent(db, EventTournamentStarted, fmt.Sprintf("Tournament %s started with %d players", tournament.ID, len(usernames)))
+	if pending != nil {
+		*pending = tournament
+	} else {
+		db.Tournaments = append(db.Tournaments, tournament)
+	}
 	log.Print("Tournament started successfully")
-	return saveDatabase(*db)
+	return saveTournament(db, getCurrentTournament(db))
 }
 
 func nextRound(db *Database) error {
@@ -268,212 +554,131 @@ func nextRound(db *Database) error {
 		return fmt.Errorf("the tournament is not in progress")
 	}
 
+	if currentPhase(tournament).Status == TournamentStatusComplete {
+		recordEvent(db, EventRoundAdvanced, "Next phase started")
+		if err := startNextPhase(tournament); err != nil {
+			return err
+		}
+		log.Print("Next phase started successfully")
+		return saveTournament(db, tournament)
+	}
+
 	currentRound := tournament.Rounds[tournament.CurrentRound]
 
 	for _, match := range currentRound.Matches {
-		if match.Winner == "" && match.Player2 != "" {
+		if match.Winner == "" {
 			return fmt.Errorf("all matches in the current round must be completed before moving to the next round")
 		}
 	}
 
-	if len(currentRound.Matches) == 1 && currentRound.Matches[0].Winner != "" {
-		tournament.Status = TournamentStatusComplete
-		return saveDatabase(*db)
+	recordEvent(db, EventRoundAdvanced, "Next round started")
+	if currentPhase(tournament).Format == FormatSwiss {
+		if err := startNextSwissRound(tournament); err != nil {
+			return err
+		}
 	}
 
-	checkAndCreateNextMatches(tournament, tournament.CurrentRound)
+	updateTournamentProgress(tournament)
 	log.Print("Next round started successfully")
-	return saveDatabase(*db)
+	return saveTournament(db, tournament)
 }
 
-// Creates matches for the first round of the tournament
-func firstRound(players []Player, tables []Table) []Match {
+// Places players, given in seed order, in the first round slots of the bracket.
+// Seed 1 faces the lowest seed, byes go to the top seeds and an empty slot is a bye.
+func firstRound(players []string) []string {
 	totalPlayers := len(players)
-	targetSize := LargestPowerOfTwo(totalPlayers) / 2
-	matchesNeeded := targetSize
+	size := LargestPowerOfTwo(totalPlayers)
 
 	log.Printf("Total Players: %d", totalPlayers)
-	log.Printf("Target Size for next round: %d", targetSize)
-	log.Printf("Matches needed: %d", matchesNeeded)
-
-	var matches []Match
-	currentPlayerIndex := 0
-	//remainingPlayers := totalPlayers
-	tableIndex := 0
-
-	playerInMatches := (totalPlayers - targetSize) * 2
-	if playerInMatches < 0 {
-		playerInMatches = totalPlayers - (totalPlayers % 2)
-	}
-	byePlayers := totalPlayers - playerInMatches
-
-	log.Print("Players in matches : ", playerInMatches)
-	log.Print("Bye Players : ", byePlayers)
+	log.Print("Bye Players : ", size-totalPlayers)
 
-	matchCounter := 1
-	matchesCreated := 0
-
-	for matchesCreated < playerInMatches/2 {
-		if currentPlayerIndex+1 >= totalPlayers {
-			break
-		}
-		match := Match{
-			ID:      fmt.Sprintf("R1M%d", matchCounter),
-			Player1: players[currentPlayerIndex].Username,
-			Player2: players[currentPlayerIndex+1].Username,
-			Winner:  "",
-			TableID: tables[tableIndex%len(tables)].ID,
-		}
-		matches = append(matches, match)
-		currentPlayerIndex += 2
-		matchCounter++
-		matchesCreated++
-		tableIndex++
-
-	}
-
-	for i := 0; i < byePlayers; i++ {
-		if currentPlayerIndex >= len(players) {
-			break
-		}
-
-		match := Match{
-			ID:      fmt.Sprintf("R1M%d", matchCounter),
-			Player1: players[currentPlayerIndex].Username,
-			Player2: "",
-			Winner:  players[currentPlayerIndex].Username, //The player automatically passes
-			TableID: "",                                   // No table needed for a bye
+	slots := make([]string, size)
+	for slot, seed := range seedOrder(size) {
+		if seed <= totalPlayers {
+			slots[slot] = players[seed-1]
 		}
-
-		matches = append(matches, match)
-		currentPlayerIndex++
-		matchCounter++
 	}
 	log.Print("First round matches created successfully")
-	return matches
+	return slots
 }
 
-// Creates matches for the next round of the tournament
-
-// Updates the result of a match
-func updateMatchResult(db *Database, matchID string, winnerName string) error {
+// Updates the result of a match. The score is optional and written from the winner's
+// side, e.g. "2-1", the winner must have won the number of games the set is played in.
+func updateMatchResult(db *Database, matchID string, winnerName string, score string) error {
 	tournament := getCurrentTournament(db)
 	if tournament == nil {
 		return fmt.Errorf("no active tournament")
 	}
 
-	matchFound := false
-	var currentRoundIndex int
-
-	for i := range tournament.Rounds {
-		for j := range tournament.Rounds[i].Matches {
-			if tournament.Rounds[i].Matches[j].ID == matchID {
-				if tournament.Rounds[i].Matches[j].Player1 != winnerName && tournament.Rounds[i].Matches[j].Player2 != winnerName {
-					return fmt.Errorf("the winner must be one of the players in the match: %s ou %s", tournament.Rounds[i].Matches[j].Player1, tournament.Rounds[i].Matches[j].Player2)
-				}
-				tournament.Rounds[i].Matches[j].Winner = winnerName
-				currentRoundIndex = i
-				matchFound = true
-				break
-
-			}
-		}
-		if matchFound {
-			break
-		}
-	}
-	if !matchFound {
+	match := findMatch(tournament, matchID)
+	if match == nil {
 		return fmt.Errorf("match not found")
 	}
+	if match.Player1 == "" || match.Player2 == "" {
+		return fmt.Errorf("the match is still waiting for its players")
+	}
+	if match.Player1 != winnerName && match.Player2 != winnerName {
+		return fmt.Errorf("the winner must be one of the players in the match: %s ou %s", match.Player1, match.Player2)
+	}
+	if match.Winner != "" {
+		return fmt.Errorf("the result of this match has already been recorded")
+	}
 
-	checkAndCreateNextMatches(tournament, currentRoundIndex)
-	log.Print("Match updated successfully")
-	return saveDatabase(*db)
-}
-
-func checkAndCreateNextMatches(tournament *Tournament, roundIndex int) {
-	currentRound := tournament.Rounds[roundIndex]
-	matches := currentRound.Matches
-	var _ []Match
-
-	for i := 0; i < len(matches); i += 2 {
-		match1 := matches[i]
-
-		if i+1 >= len(matches) {
-			if match1.Winner != "" && match1.Player2 == "" {
-				createNextRoundMatch(tournament, []Match{match1}, roundIndex)
-			}
-			continue
+	winnerGames, loserGames := 0, 0
+	if score != "" {
+		var err error
+		winnerGames, loserGames, err = parseScore(score)
+		if err != nil {
+			return err
 		}
-
-		match2 := matches[i+1]
-
-		if match1.Winner != "" && match2.Winner != "" {
-			createNextRoundMatch(tournament, []Match{match1, match2}, roundIndex)
+		if err := checkScore(*match, winnerName, winnerGames, loserGames); err != nil {
+			return err
 		}
 	}
 
-	allMatchesComplete := true
-	for _, match := range matches {
-		if match.Winner == "" && match.Player2 != "" {
-			allMatchesComplete = false
-			break
-		}
+	player1Games, player2Games := winnerGames, loserGames
+	if winnerName == match.Player2 {
+		player1Games, player2Games = loserGames, winnerGames
 	}
-
-	if allMatchesComplete {
-		if len(matches) == 1 {
-			tournament.Status = TournamentStatusComplete
-		} else {
-			tournament.CurrentRound++
+	// Without a score, keep the games already recorded for the set, as long as
+	// the winner is ahead in them
+	if score == "" {
+		player1Games, player2Games = gameWins(*match)
+		winnerWins, loserWins := player1Games, player2Games
+		if winnerName == match.Player2 {
+			winnerWins, loserWins = loserWins, winnerWins
+		}
+		if len(match.Games) > 0 && winnerWins <= loserWins {
+			return fmt.Errorf("the %d games already recorded do not give %s the lead, report the score of the set", len(match.Games), winnerName)
 		}
 	}
+	recordEvent(db, EventMatchReported, strings.TrimSpace(fmt.Sprintf("Match %s won by %s %s", match.ID, winnerName, score)))
+	completeMatch(tournament, match, winnerName, player1Games, player2Games)
+	log.Print("Match updated successfully")
+	return saveTournament(db, tournament)
 }
 
-func getMatchNumber(matchID string) int {
-	var roundNum, matchNum int
-	fmt.Sscanf(matchID, "R%dM%d", &roundNum, &matchNum)
-	return matchNum
+// Records the winner and the score of a set and moves the bracket forward
+func completeMatch(tournament *Tournament, match *Match, winnerName string, player1Games, player2Games int) {
+	match.Winner = winnerName
+	match.StageSelection = nil
+	match.Report = nil
+	match.Player1Score, match.Player2Score = player1Games, player2Games
+	releaseTable(tournament, match)
+	advanceMatch(tournament, match)
+	updateTournamentProgress(tournament)
 }
 
-func createNextRoundMatch(tournament *Tournament, previousMatches []Match, currentRoundIndex int) {
-	nextRoundNumber := currentRoundIndex + 2
-	matchNumber := (getMatchNumber(previousMatches[0].ID) + 1) / 2
-
-	newMatch := Match{
-		ID:      fmt.Sprintf("R%dM%d", nextRoundNumber, matchNumber),
-		Player1: previousMatches[0].Winner,
-	}
-
-	if len(previousMatches) > 1 {
-		newMatch.Player2 = previousMatches[1].Winner
-		if len(tournament.Tables) > 0 {
-			newMatch.TableID = tournament.Tables[matchNumber%len(tournament.Tables)].ID
-		}
-	} else {
-		newMatch.Winner = previousMatches[0].Winner
-	}
-	if len(tournament.Rounds) <= currentRoundIndex+1 {
-		tournament.Rounds = append(tournament.Rounds, Round{
-			Matches: []Match{},
-		})
-	}
-
-	matchExists := false
-	for i, existingMatch := range tournament.Rounds[currentRoundIndex+1].Matches {
-		if existingMatch.ID == newMatch.ID {
-			tournament.Rounds[currentRoundIndex+1].Matches[i] = newMatch
-			matchExists = true
-			break
-		}
+// Parses a set score written from the winner's side, e.g. "2-1"
+func parseScore(score string) (int, int, error) {
+	var winnerGames, loserGames int
+	if _, err := fmt.Sscanf(score, "%d-%d", &winnerGames, &loserGames); err != nil {
+		return 0, 0, fmt.Errorf("invalid score %q, expected a format like 2-1", score)
 	}
-
-	if !matchExists {
-		tournament.Rounds[currentRoundIndex+1].Matches = append(
-			tournament.Rounds[currentRoundIndex+1].Matches,
-			newMatch,
-		)
+	if winnerGames <= loserGames || loserGames < 0 {
+		return 0, 0, fmt.Errorf("invalid score %q, the winner must have won more games", score)
 	}
+	return winnerGames, loserGames, nil
 }
 
 func getTournamentStatus(db Database) string {
@@ -481,49 +686,63 @@ func getTournamentStatus(db Database) string {
 	if tournament == nil {
 		return "No tournaments in progress."
 	}
+	if pendingTournament(&db) != nil {
+		registration := tournament.Registration
+		signups := "closed"
+		if registration.Open {
+			signups = "open"
+		}
+		return fmt.Sprintf("Tournament %s has not started yet.\nSign-ups are %s: %d entrants, %d on the waitlist.\nUse /%s tournament start to start it with the entrants.",
+			tournament.ID, signups, len(registration.Entrants), len(registration.Waitlist), BOT_COMMAND_PREFIX)
+	}
 
+	if len(tournament.Rounds) == 0 {
+		return fmt.Sprintf("Tournament %s has no matches yet.", tournament.ID)
+	}
+
+	phase := currentPhase(tournament)
 	if tournament.Status == TournamentStatusComplete {
-		winner := tournament.Rounds[len(tournament.Rounds)-1].Matches[0].Winner
-		return fmt.Sprintf("Tournament is complete. Winner: %s", winner)
+		if hasStandings(phase.Format) {
+			return "Tournament is complete. Final standings:\n\n" + formatStandings(tournament, tournament.CurrentPhase)
+		}
+		return fmt.Sprintf("Tournament is complete. Winner: %s", tournamentWinner(tournament))
 	}
 
+	currentRound := tournament.Rounds[tournament.CurrentRound]
 	status := fmt.Sprintf("Tournament status (ID: %s):\n", tournament.ID)
 	status += fmt.Sprintf("Status: %s\n", tournament.Status)
-	status += fmt.Sprintf("Current Round: %d\n\n", tournament.CurrentRound+1)
+	if len(tournament.Phases) > 1 {
+		status += fmt.Sprintf("Phase: %s (%d/%d)\n", phase.Name, tournament.CurrentPhase+1, len(tournament.Phases))
+	}
+	if phase.Status == TournamentStatusComplete {
+		status += fmt.Sprintf("\n%s complete. Use /%s tournament next to start the next phase.\n\n", phase.Name, BOT_COMMAND_PREFIX)
+		return status + formatStandings(tournament, tournament.CurrentPhase)
+	}
+	status += fmt.Sprintf("Current Round: %s\n\n", roundName(currentRound))
 
-	currentRound := tournament.Rounds[tournament.CurrentRound]
 	status += "Current Matches:\n"
-
 	for _, match := range currentRound.Matches {
-		if match.Player2 == "" {
-			status += fmt.Sprintf("Match %s: %s (Bye)\n", match.ID, match.Player1)
-			continue
-		}
-		status += fmt.Sprintf("Match %s: %s vs %s", match.ID, match.Player1, match.Player2)
-		if match.Winner != "" {
-			status += fmt.Sprintf(" (Winner: %s)", match.Winner)
-		}
-		if match.TableID != "" {
-			status += fmt.Sprintf(" (Table: %s)", match.TableID)
-		}
-		status += "\n"
-	}
-
-	if len(tournament.Rounds) > tournament.CurrentRound+1 {
-		nextRound := tournament.Rounds[tournament.CurrentRound+1]
-		if len(nextRound.Matches) > 0 {
-			status += "\nNext Round Matches:\n"
-			for _, match := range nextRound.Matches {
-				if match.Player2 != "" {
-					status += fmt.Sprintf("Match %s: %s vs %s (Table: %s)\n",
-						match.ID,
-						match.Player1,
-						match.Player2,
-						match.TableID)
-				}
+		status += formatMatchStatus(match)
+	}
+
+	var upcoming []Match
+	for _, round := range tournament.Rounds[tournament.CurrentRound+1:] {
+		for _, match := range round.Matches {
+			if isMatchReady(match) {
+				upcoming = append(upcoming, match)
 			}
 		}
 	}
+	if len(upcoming) > 0 {
+		status += "\nNext Round Matches:\n"
+		for _, match := range upcoming {
+			status += formatMatchStatus(match)
+		}
+	}
+
+	if hasStandings(phase.Format) {
+		status += "\nStandings:\n" + formatStandings(tournament, tournament.CurrentPhase)
+	}
 
 	return status
 }
@@ -543,15 +762,25 @@ func getReadyNextMatches(tournament *Tournament) []Match {
 }
 
 func formatMatchStatus(match Match) string {
-	if match.Player2 == "" {
+	if match.Bye {
 		return fmt.Sprintf("Match %s: %s (Bye)\n",
-			match.ID, match.Player1)
+			match.ID, orTBD(match.Player1))
 	}
 
 	status := fmt.Sprintf("Match %s: %s vs %s",
-		match.ID, match.Player1, match.Player2)
+		match.ID, orTBD(match.Player1), orTBD(match.Player2))
+	if match.BestOf > 0 {
+		status += fmt.Sprintf(" (Bo%d)", match.BestOf)
+	}
 	if match.Winner != "" {
-		status += fmt.Sprintf(" (Winner: %s)", match.Winner)
+		if score := formatScore(match); score != "" {
+			status += fmt.Sprintf(" (Winner: %s %s)", match.Winner, score)
+		} else {
+			status += fmt.Sprintf(" (Winner: %s)", match.Winner)
+		}
+	} else if len(match.Games) > 0 {
+		player1Wins, player2Wins := gameWins(match)
+		status += fmt.Sprintf(" (Games: %d-%d)", player1Wins, player2Wins)
 	}
 	if match.TableID != "" {
 		status += fmt.Sprintf(" (Table: %s)", match.TableID)
@@ -559,6 +788,14 @@ func formatMatchStatus(match Match) string {
 	return status + "\n"
 }
 
+// Returns the name of a player or TBD when the slot is still empty
+func orTBD(player string) string {
+	if player == "" {
+		return "TBD"
+	}
+	return player
+}
+
 // Returns the nearest even number
 func LargestPowerOfTwo(n int) int {
 	if n <= 0 {
@@ -568,48 +805,99 @@ func LargestPowerOfTwo(n int) int {
 	return int(math.Pow(2, power))
 }
 
-func verifySecurityCode(clearType string, userCode string) error {
+func verifySecurityCode(guildID string, clearType string, userCode string) error {
 	inputCode, err := strconv.Atoi(userCode)
 	if err != nil {
 		return fmt.Errorf("invalid security code : %v", err)
 	}
 
-	if inputCode != securityCodes[clearType] {
+	securityCodesMu.Lock()
+	defer securityCodesMu.Unlock()
+	key := guildID + "/" + clearType
+	pending, ok := securityCodes[key]
+	if ok && time.Now().After(pending.expires) {
+		delete(securityCodes, key)
+		return fmt.Errorf("the security code expired, run clear again")
+	}
+	if !ok || inputCode != pending.code {
 		return fmt.Errorf("incorrect security code")
 	}
+	// A code confirms a single clear
+	delete(securityCodes, key)
 	log.Print("Security code verified successfully")
 	return nil
 }
 
-func generateSecurityCode(clearType string) int {
+func generateSecurityCode(guildID string, clearType string) int {
 	code := rand.Int() % 100000
-	securityCodes[clearType] = code
-	log.Print("Security code generated: ", code)
+	securityCodesMu.Lock()
+	defer securityCodesMu.Unlock()
+	securityCodes[guildID+"/"+clearType] = securityCode{
+		code:    code,
+		expires: time.Now().Add(securityCodeTimeout * time.Minute),
+	}
+	log.Print("Security code generated successfully")
 	return code
 }
 
 func clearTournament(db *Database) error {
+	recordEvent(db, EventTournamentCleared, "Tournaments cleared")
 	db.Tournaments = []Tournament{}
 	return saveDatabase(*db)
 }
 
 func clearPlayers(db *Database) error {
+	recordEvent(db, EventPlayersCleared, "Players cleared")
 	db.Players = []Player{}
-	return saveDatabase(*db)
+	return savePlayers(db)
 }
 
 func clearTables(db *Database) error {
+	recordEvent(db, EventTablesCleared, "Tables cleared")
 	db.Tables = []Table{}
-	return saveDatabase(*db)
+	return saveTables(db)
 }
 
 func clearDatabase(db *Database) error {
+	recordEvent(db, EventDatabaseCleared, "Players, tables and tournaments cleared")
 	db.Players = []Player{}
 	db.Tables = []Table{}
 	db.Tournaments = []Tournament{}
 	return saveDatabase(*db)
 }
 
+// Returns the options of the subcommands recording and changing a match result
+func matchResultOptions() []*discordgo.ApplicationCommandOption {
+	return []*discordgo.ApplicationCommandOption{
+		{
+			Name:         "match_id",
+			Description:  "ID of the match",
+			Type:         discordgo.ApplicationCommandOptionString,
+			Required:     true,
+			Autocomplete: true,
+		},
+		{
+			Name:         "winner",
+			Description:  "Name of the winner",
+			Type:         discordgo.ApplicationCommandOptionString,
+			Required:     false,
+			Autocomplete: true,
+		},
+		{
+			Name:        "score",
+			Description: "Set score from the winner's side, e.g. 2-1",
+			Type:        discordgo.ApplicationCommandOptionString,
+			Required:    false,
+		},
+		{
+			Name:        "winner_user",
+			Description: "Winner as a mention, instead of the name",
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Required:    false,
+		},
+	}
+}
+
 func registerCommands(s *discordgo.Session) {
 	log.Print("Registering commands...")
 
@@ -618,6 +906,12 @@ func registerCommands(s *discordgo.Session) {
 		return
 	}
 
+	minPools := 1.0
+	minStocks := 1.0
+	minTimeout := 1.0
+	minCap := 2.0
+	// Hides admin commands from regular members, server admins can still grant them to roles
+	var adminPermissions int64 = discordgo.PermissionManageServer
 	commands := []*discordgo.ApplicationCommand{
 		{
 			Name:        "activedevbadge",
@@ -645,6 +939,12 @@ func registerCommands(s *discordgo.Session) {
 									Type:        discordgo.ApplicationCommandOptionString,
 									Required:    true,
 								},
+								{
+									Name:        "user",
+									Description: "Discord account of the player",
+									Type:        discordgo.ApplicationCommandOptionUser,
+									Required:    false,
+								},
 							},
 						},
 						{
@@ -674,10 +974,11 @@ func registerCommands(s *discordgo.Session) {
 							Type:        discordgo.ApplicationCommandOptionSubCommand,
 							Options: []*discordgo.ApplicationCommandOption{
 								{
-									Name:        "username",
-									Description: "Name of the player",
-									Type:        discordgo.ApplicationCommandOptionString,
-									Required:    true,
+									Name:         "username",
+									Description:  "Name of the player",
+									Type:         discordgo.ApplicationCommandOptionString,
+									Required:     true,
+									Autocomplete: true,
 								},
 							},
 						},
@@ -696,6 +997,47 @@ func registerCommands(s *discordgo.Session) {
 						},
 					},
 				},
+				{
+					Name:        "register",
+					Description: "Register yourself as a player",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "username",
+							Description: "Name to play under (your Discord username by default)",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+						},
+					},
+				},
+				{
+					Name:        "seed",
+					Description: "Set the seed or rating of a player",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "username",
+							Description:  "Name of the player",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "seed",
+							Description: "Seed of the player, 1 being the best",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minPools,
+						},
+						{
+							Name:        "rating",
+							Description: "Rating used to seed players without a manual seed",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minPools,
+						},
+					},
+				},
 				{
 					Name:        "list",
 					Description: "List of player or tables",
@@ -726,7 +1068,7 @@ func registerCommands(s *discordgo.Session) {
 					Options: []*discordgo.ApplicationCommandOption{
 						{
 							Name:        "action",
-							Description: "Action to be taken (start/next/status)",
+							Description: "Action to be taken (start/next/status/standings/open/close)",
 							Type:        discordgo.ApplicationCommandOptionString,
 							Required:    true,
 							Choices: []*discordgo.ApplicationCommandOptionChoice{
@@ -742,29 +1084,321 @@ func registerCommands(s *discordgo.Session) {
 									Name:  "status",
 									Value: "status",
 								},
+								{
+									Name:  "standings",
+									Value: "standings",
+								},
+								{
+									Name:  "open",
+									Value: "open",
+								},
+								{
+									Name:  "close",
+									Value: "close",
+								},
 							},
 						},
-					},
-				},
-				{
-					Name:        "match",
-					Description: "Manage match results",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-					Options: []*discordgo.ApplicationCommandOption{
 						{
-							Name:        "match_id",
-							Description: "ID of the match",
+							Name:        "format",
+							Description: "Bracket format used by start (double elimination by default)",
 							Type:        discordgo.ApplicationCommandOptionString,
-							Required:    true,
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{
+									Name:  "Double elimination",
+									Value: string(FormatDoubleElimination),
+								},
+								{
+									Name:  "Single elimination",
+									Value: string(FormatSingleElimination),
+								},
+								{
+									Name:  "Round robin pools",
+									Value: string(FormatRoundRobin),
+								},
+								{
+									Name:  "Swiss",
+									Value: string(FormatSwiss),
+								},
+							},
 						},
 						{
-							Name:        "winner",
-							Description: "Name of the winner",
-							Type:        discordgo.ApplicationCommandOptionString,
-							Required:    true,
+							Name:        "pools",
+							Description: "Number of pools for a round robin (1 by default)",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minPools,
 						},
-					},
+						{
+							Name:        "rounds",
+							Description: "Number of Swiss rounds, at most half the players (enough to find a single winner by default)",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minPools,
+						},
+						{
+							Name:        "advance",
+							Description: "Players per pool moving on to a bracket once pools or Swiss rounds are over",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minPools,
+						},
+						{
+							Name:        "bracket",
+							Description: "Format of the bracket played after pools or Swiss (double elimination by default)",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{
+									Name:  "Double elimination",
+									Value: string(FormatDoubleElimination),
+								},
+								{
+									Name:  "Single elimination",
+									Value: string(FormatSingleElimination),
+								},
+							},
+						},
+						{
+							Name:        "game",
+							Description: "Game the tournament is played on (Ultimate by default)",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{
+									Name:  "Super Smash Bros. Ultimate",
+									Value: string(GameUltimate),
+								},
+								{
+									Name:  "Super Smash Bros. Melee",
+									Value: string(GameMelee),
+								},
+							},
+						},
+						{
+							Name:        "cap",
+							Description: "Most entrants taken by open, later players go on a waitlist (no cap by default)",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minCap,
+						},
+						{
+							Name:        "closes_in",
+							Description: "Minutes before the sign-ups of open close on their own (open until closed by default)",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minTimeout,
+						},
+					},
+				},
+				{
+					Name:        "match",
+					Description: "Manage match results",
+					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "result",
+							Description: "Record the result of a match being played",
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Options:     matchResultOptions(),
+						},
+						{
+							Name:        "edit",
+							Description: "Change the result of a finished match",
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Options:     matchResultOptions(),
+						},
+					},
 				},
+				{
+					Name:        "report",
+					Description: "Report the result of your own set, your opponent confirms it",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "match_id",
+							Description:  "ID of the match",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "score",
+							Description: "Set score from the winner's side, e.g. 2-1",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+						{
+							Name:         "winner",
+							Description:  "Name of the winner",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     false,
+							Autocomplete: true,
+						},
+						{
+							Name:        "winner_user",
+							Description: "Winner as a mention, instead of the name",
+							Type:        discordgo.ApplicationCommandOptionUser,
+							Required:    false,
+						},
+					},
+				},
+				{
+					Name:        "disputes",
+					Description: "List the disputed results waiting for an organizer",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "game",
+					Description: "Record a single game of a set",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "match_id",
+							Description:  "ID of the match",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:         "winner",
+							Description:  "Name of the winner of the game",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "winner_character",
+							Description: "Character played by the winner",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+						},
+						{
+							Name:        "loser_character",
+							Description: "Character played by the loser",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+						},
+						{
+							Name:        "stage",
+							Description: "Stage the game was played on",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+						},
+						{
+							Name:        "stocks",
+							Description: "Stocks the winner had left",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minStocks,
+						},
+					},
+				},
+				{
+					Name:        "stats",
+					Description: "Display the most played characters and stage win rates",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "player",
+							Description: "Only count the games of this player",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+						},
+					},
+				},
+				{
+					Name:        "stages",
+					Description: "Start stage striking or counterpicking for the next game of a match",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "match_id",
+							Description:  "ID of the match",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "ruleset",
+					Description: "Set the stage rules of the current tournament",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "starters",
+							Description: "Starter stages, comma separated",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+						{
+							Name:        "bans",
+							Description: "Stages banned by the winner before each counterpick",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+						},
+						{
+							Name:        "counterpicks",
+							Description: "Counterpick stages, comma separated (none by default)",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    false,
+						},
+						{
+							Name:        "dsr",
+							Description: "Forbid counterpicking a stage already won on in the set (on by default)",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Required:    false,
+						},
+					},
+				},
+				{
+					Name:        "bestof",
+					Description: "Set the number of games of the sets of a round",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "round",
+							Description: "ID of the round, e.g. R1, L3 or GF",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+						},
+						{
+							Name:        "best_of",
+							Description: "Number of games, e.g. 3 or 5",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "panels",
+					Description: "Post a report panel with buttons for each match being played",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "undo",
+					Description: "Revert the latest change to players, tables or tournaments",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "history",
+					Description: "Display the latest changes to players, tables and tournaments",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "help",
+					Description: "Display all available commands",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+			},
+		},
+		{
+			Name:                     ADMIN_COMMAND_PREFIX,
+			Description:              "Server administration commands",
+			Type:                     discordgo.ApplicationCommandType(1),
+			DefaultMemberPermissions: &adminPermissions,
+			Options: []*discordgo.ApplicationCommandOption{
 				{
 					Name:        "clear",
 					Description: "clear the database",
@@ -833,14 +1467,9 @@ func registerCommands(s *discordgo.Session) {
 						},
 					},
 				},
-				{
-					Name:        "help",
-					Description: "Display all available commands",
-					Type:        discordgo.ApplicationCommandOptionSubCommand,
-				},
 				{
 					Name:        "server",
-					Description: "Manage web server",
+					Description: "Start or stop serving the bracket of this server on the web server",
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Options: []*discordgo.ApplicationCommandOption{
 						{
@@ -861,6 +1490,85 @@ func registerCommands(s *discordgo.Session) {
 						},
 					},
 				},
+				{
+					Name:        "settings",
+					Description: "Change the bot settings",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "report_timeout",
+							Description: "Minutes before an unanswered report is confirmed",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &minTimeout,
+						},
+					},
+				},
+				{
+					Name:        "callouts",
+					Description: "Call ready matches in a channel and ping players who don't check in",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "Channel matches are called in, none to stop calling them",
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+							Required:     false,
+						},
+						{
+							Name:        "checkin_timeout",
+							Description: "Minutes before players who didn't check in are pinged again",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    false,
+							MinValue:    &minTimeout,
+						},
+					},
+				},
+				{
+					Name:        "threads",
+					Description: "Open a thread for each match being played",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "Channel threads are opened under, none to stop opening them",
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+							Required:     false,
+						},
+						{
+							Name:        "private",
+							Description: "Only the players of the match and organizers see the thread",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Required:    false,
+						},
+					},
+				},
+				{
+					Name:        "claim",
+					Description: "Move the data saved before the bot joined several servers to this server",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "roles",
+					Description: "Set the organizer and admin roles of this server",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "to_role",
+							Description: "Role of tournament organizers",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    true,
+						},
+						{
+							Name:        "admin_role",
+							Description: "Role allowed to clear data and run the web server",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    false,
+						},
+					},
+				},
 			},
 		},
 	}
@@ -875,6 +1583,122 @@ func registerCommands(s *discordgo.Session) {
 	log.Println("Commands registered successfully!")
 }
 
+// Returns the option with the given name or nil when it was not provided
+func getOption(options []*discordgo.ApplicationCommandInteractionDataOption, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	for _, opt := range options {
+		if opt.Name == name {
+			return opt
+		}
+	}
+	return nil
+}
+
+// Sends a response only the user who clicked or typed the command can see
+func sendEphemeralResponse(s *discordgo.Session, i *discordgo.InteractionCreate, title, description string, color int) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       title,
+					Description: description,
+					Color:       color,
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		return
+	}
+}
+
+// Returns the user behind an interaction, in a server or in DMs
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// Posts what the last changes of a server's matches call for: threads opened
+// and archived, then call-outs linking to them
+func followUpChanges(s *discordgo.Session, guildID string) {
+	syncMatchThreads(s, guildID)
+	announceMatches(s, guildID)
+}
+
+// Routes clicks on message buttons by the prefix of their custom ID
+func handleComponents(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer followUpChanges(s, i.GuildID)
+	db, unlock, err := state.acquire(i.GuildID)
+	if err != nil {
+		sendEphemeralResponse(s, i, "Erreur", "Error loading database: "+err.Error(), 0xFF0000)
+		return
+	}
+	defer unlock()
+	if user := interactionUser(i); user != nil {
+		db.actor = user.Username
+	}
+
+	parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 3)
+	switch parts[0] {
+	case stageButtonPrefix:
+		if len(parts) < 3 {
+			return
+		}
+		handleStageButton(s, i, db, parts[1], parts[2])
+	case reportButtonPrefix:
+		if len(parts) < 3 {
+			return
+		}
+		handleReportButton(s, i, db, parts[1], parts[2])
+	case editButtonPrefix:
+		if len(parts) < 3 {
+			return
+		}
+		handleEditButton(s, i, db, parts[1], parts[2])
+	case panelPrefix:
+		if len(parts) < 3 {
+			return
+		}
+		handlePanelComponent(s, i, db, parts[1], parts[2])
+	case checkInButtonPrefix:
+		if len(parts) < 2 {
+			return
+		}
+		handleCheckInButton(s, i, db, parts[1])
+	case signupButtonPrefix:
+		if len(parts) < 3 {
+			return
+		}
+		handleSignupButton(s, i, db, parts[1], parts[2])
+	}
+}
+
+// Routes submitted forms by the prefix of their custom ID
+func handleModals(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer followUpChanges(s, i.GuildID)
+	db, unlock, err := state.acquire(i.GuildID)
+	if err != nil {
+		sendEphemeralResponse(s, i, "Erreur", "Error loading database: "+err.Error(), 0xFF0000)
+		return
+	}
+	defer unlock()
+	if user := interactionUser(i); user != nil {
+		db.actor = user.Username
+	}
+
+	parts := strings.SplitN(i.ModalSubmitData().CustomID, ":", 3)
+	switch parts[0] {
+	case panelPrefix:
+		if len(parts) < 3 {
+			return
+		}
+		handlePanelModal(s, i, db, parts[2])
+	}
+}
+
 func sendInteractionResponse(s *discordgo.Session, i *discordgo.InteractionCreate, title, description string, color int) {
 	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
@@ -904,17 +1728,48 @@ func serveTournamentData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := loadDatabase()
+	guilds, err := dataStore.Guilds()
 	if err != nil {
 		http.Error(w, "Error loading database", http.StatusInternalServerError)
 		return
 	}
+	guildID := r.URL.Query().Get("guild")
+	if guildID == "" {
+		// The guild can be left out when the bot is in a single server
+		if len(guilds) != 1 {
+			http.Error(w, "Missing guild parameter", http.StatusBadRequest)
+			return
+		}
+		guildID = guilds[0]
+	}
 
+	// Unknown servers and servers that did not start serving their bracket look the same
+	known := false
+	for _, id := range guilds {
+		known = known || (id == guildID && id != legacyGuildID)
+	}
+	if !known {
+		http.Error(w, "The bracket of this server is not served", http.StatusNotFound)
+		return
+	}
+	db, err := state.snapshot(guildID)
+	if err != nil {
+		http.Error(w, "Error loading database", http.StatusInternalServerError)
+		return
+	}
+	if !db.Settings.WebBracketServed {
+		http.Error(w, "The bracket of this server is not served", http.StatusNotFound)
+		return
+	}
 	tournament := getCurrentTournament(db)
 	if tournament == nil {
 		http.Error(w, "No active tournament", http.StatusNotFound)
 		return
 	}
+	if pendingTournament(db) != nil {
+		http.Error(w, "The tournament has not started yet", http.StatusNotFound)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(tournament); err != nil {
@@ -923,46 +1778,34 @@ func serveTournamentData(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func startWebServer() error {
-	if webServer != nil {
-		return fmt.Errorf("server is already running")
+// Starts or stops serving the bracket of a server on the web server. Brackets
+// are only served once an admin of their server starts them.
+func setWebBracket(db *Database, served bool) error {
+	if served && db.Settings.WebBracketServed {
+		return fmt.Errorf("the bracket of this server is already served")
 	}
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/tournament", serveTournamentData)
-	mux.Handle("/", http.FileServer(http.Dir("public")))
-
-	webServer = &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+	if !served && !db.Settings.WebBracketServed {
+		return fmt.Errorf("the bracket of this server is not served")
 	}
-
-	go func() {
-		if err := webServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
-		}
-	}()
-
-	log.Printf("Web server started on http://localhost:8080")
-	return nil
-}
-
-func stopWebServer() error {
-	if webServer == nil {
-		return fmt.Errorf("no server is running")
-	}
-
-	if err := webServer.Close(); err != nil {
-		return fmt.Errorf("error stopping server: %v", err)
-	}
-
-	webServer = nil
-	log.Printf("Web server stopped")
-	return nil
+	db.Settings.WebBracketServed = served
+	log.Print("Web bracket updated successfully")
+	return saveSettings(db)
 }
 
 // Main function to handle commands
 func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionMessageComponent {
+		handleComponents(s, i)
+		return
+	}
+	if i.Type == discordgo.InteractionModalSubmit {
+		handleModals(s, i)
+		return
+	}
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		handleAutocomplete(s, i)
+		return
+	}
 	if i.Type != discordgo.InteractionApplicationCommand {
 		return
 	}
@@ -977,13 +1820,19 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		log.Print("Active Developer Badge sent successfully")
 		return
 
-	case BOT_COMMAND_PREFIX:
-		// Load the database
-		db, err := loadDatabase()
+	case BOT_COMMAND_PREFIX, ADMIN_COMMAND_PREFIX:
+		// Load the database, other commands of the server wait until this one is done
+		// Matches the command made ready are called once it is done
+		defer followUpChanges(s, i.GuildID)
+		db, unlock, err := state.acquire(i.GuildID)
 		if err != nil {
-			sendInteractionResponse(s, i, "Erreur", "Error loading database", 0xFF0000)
+			sendInteractionResponse(s, i, "Erreur", "Error loading database: "+err.Error(), 0xFF0000)
 			return
 		}
+		defer unlock()
+		if user := interactionUser(i); user != nil {
+			db.actor = user.Username
+		}
 
 		if len(data.Options) == 0 {
 			sendInteractionResponse(s, i, "Erreur", "Commande invalide", 0xFF0000)
@@ -991,7 +1840,42 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		}
 
 		groupCmd := data.Options[0]
+		if !checkPermission(db, i, groupCmd) {
+			sendEphemeralResponse(s, i, "Erreur", "You are not allowed to run this command", 0xFF0000)
+			return
+		}
 		switch groupCmd.Name {
+		case "roles":
+			if len(groupCmd.Options) == 0 {
+				sendInteractionResponse(s, i, "Erreur", "Organizer role required", 0xFF0000)
+				return
+			}
+			organizerRole := groupCmd.Options[0].RoleValue(nil, i.GuildID).ID
+			var adminRole string
+			if opt := getOption(groupCmd.Options, "admin_role"); opt != nil {
+				adminRole = opt.RoleValue(nil, i.GuildID).ID
+			}
+			if err := setGuildRoles(db, organizerRole, adminRole); err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error updating roles: "+err.Error(), 0xFF0000)
+				return
+			}
+			description := fmt.Sprintf("Organizer role: <@&%s>", organizerRole)
+			if adminRole != "" {
+				description += fmt.Sprintf("\nAdmin role: <@&%s>", adminRole)
+				// Discord hides /smashbot-admin from members who can't manage the server,
+				// whatever the bot allows
+				description += fmt.Sprintf("\n\nMembers of this role who can't manage the server only see `/%s` once it is allowed for the role in Server Settings > Integrations.", ADMIN_COMMAND_PREFIX)
+			}
+			sendInteractionResponse(s, i, "Succès", description, 0x00FF00)
+			log.Print("Roles updated successfully")
+
+		case "claim":
+			if err := claimLegacyData(db); err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error claiming data: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Data claimed: %d players, %d tables and %d tournaments", len(db.Players), len(db.Tables), len(db.Tournaments)), 0x00FF00)
+
 		case "server":
 			if len(groupCmd.Options) == 0 {
 				sendInteractionResponse(s, i, "Error", "Missing action", 0xFF0000)
@@ -1001,18 +1885,18 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			action := groupCmd.Options[0].StringValue()
 			switch action {
 			case "start":
-				if err := startWebServer(); err != nil {
+				if err := setWebBracket(db, true); err != nil {
 					sendInteractionResponse(s, i, "Error", fmt.Sprintf("Failed to start server: %v", err), 0xFF0000)
 					return
 				}
-				sendInteractionResponse(s, i, "Success", "Web server started on http://localhost:8080", 0x00FF00)
+				sendInteractionResponse(s, i, "Success", fmt.Sprintf("Bracket served on http://localhost:8080/?guild=%s", i.GuildID), 0x00FF00)
 
 			case "stop":
-				if err := stopWebServer(); err != nil {
+				if err := setWebBracket(db, false); err != nil {
 					sendInteractionResponse(s, i, "Error", fmt.Sprintf("Failed to stop server: %v", err), 0xFF0000)
 					return
 				}
-				sendInteractionResponse(s, i, "Success", "Web server stopped", 0x00FF00)
+				sendInteractionResponse(s, i, "Success", "The bracket of this server is not served anymore", 0x00FF00)
 			}
 		case "add":
 			if len(groupCmd.Options) == 0 {
@@ -1032,6 +1916,9 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 					ID:       uuid.New().String(),
 					Username: username,
 				}
+				if opt := getOption(subCmd.Options, "user"); opt != nil {
+					newPlayer.DiscordID = opt.UserValue(nil).ID
+				}
 				err = addPlayer(db, newPlayer)
 				if err != nil {
 					sendInteractionResponse(s, i, "Erreur", "Error adding player: "+err.Error(), 0xFF0000)
@@ -1092,6 +1979,31 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				log.Print("Tables removed successfully")
 			}
 
+		case "seed":
+			if len(groupCmd.Options) == 0 {
+				sendInteractionResponse(s, i, "Erreur", "Missing player name", 0xFF0000)
+				return
+			}
+			username := groupCmd.Options[0].StringValue()
+			var seed, rating int
+			if opt := getOption(groupCmd.Options, "seed"); opt != nil {
+				seed = int(opt.IntValue())
+			}
+			if opt := getOption(groupCmd.Options, "rating"); opt != nil {
+				rating = int(opt.IntValue())
+			}
+			if seed == 0 && rating == 0 {
+				sendInteractionResponse(s, i, "Erreur", "A seed or a rating is required", 0xFF0000)
+				return
+			}
+			err = setPlayerSeed(db, username, seed, rating)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error updating seed: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Seeding of %s updated!", username), 0x00FF00)
+			log.Print("Player seed updated successfully")
+
 		case "list":
 			if len(groupCmd.Options) == 0 {
 				sendInteractionResponse(s, i, "Erreur", "Missing list type", 0xFF0000)
@@ -1116,31 +2028,111 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			action := groupCmd.Options[0].StringValue()
 			switch action {
 			case "start":
-				err := startTournament(db)
+				var options TournamentOptions
+				if opt := getOption(groupCmd.Options, "format"); opt != nil {
+					options.Format = TournamentFormat(opt.StringValue())
+				}
+				if opt := getOption(groupCmd.Options, "pools"); opt != nil {
+					options.Pools = int(opt.IntValue())
+				}
+				if opt := getOption(groupCmd.Options, "rounds"); opt != nil {
+					options.SwissRounds = int(opt.IntValue())
+				}
+				if opt := getOption(groupCmd.Options, "advance"); opt != nil {
+					options.Advance = int(opt.IntValue())
+				}
+				if opt := getOption(groupCmd.Options, "bracket"); opt != nil {
+					options.BracketFormat = TournamentFormat(opt.StringValue())
+				}
+				if opt := getOption(groupCmd.Options, "game"); opt != nil {
+					options.Game = GameTitle(opt.StringValue())
+				}
+				err := startTournament(db, options)
 				if err != nil {
 					sendInteractionResponse(s, i, "Erreur", "Tournament startup error : "+err.Error(), 0xFF0000)
 					return
 				}
 				tournament := getCurrentTournament(db)
+				refreshRegistration(s, tournament)
 				var matchesInfo strings.Builder
 				matchesInfo.WriteString(fmt.Sprintf("Tournoi ID: %s\n\n", tournament.ID))
-				matchesInfo.WriteString("List of players:\n")
+				matchesInfo.WriteString("List of players (by seed):\n")
 				for i, player := range tournament.Players {
 					matchesInfo.WriteString(fmt.Sprintf("%d. %s\n", i+1, player))
 				}
+				for p, pool := range currentPhase(tournament).Pools {
+					matchesInfo.WriteString(fmt.Sprintf("\nPool %d: %s\n", p+1, strings.Join(pool, ", ")))
+				}
 				matchesInfo.WriteString("\nFirst-round matches:\n")
 				for _, match := range tournament.Rounds[0].Matches {
-					matchesInfo.WriteString(fmt.Sprintf("Match %s: %s vs %s (Table: %s)\n",
-						match.ID, match.Player1, match.Player2, match.TableID))
+					matchesInfo.WriteString(formatMatchStatus(match))
 				}
 				sendInteractionResponse(s, i, "Tournament started", matchesInfo.String(), 0x00FF00)
 				log.Print("Tournament started successfully")
 
+			case "open":
+				var limit int
+				if opt := getOption(groupCmd.Options, "cap"); opt != nil {
+					limit = int(opt.IntValue())
+				}
+				var closesAt time.Time
+				if opt := getOption(groupCmd.Options, "closes_in"); opt != nil {
+					closesAt = time.Now().Add(time.Duration(opt.IntValue()) * time.Minute)
+				}
+				tournament, err := newRegistration(db, limit, closesAt)
+				if err != nil {
+					sendInteractionResponse(s, i, "Erreur", "Error opening sign-ups: "+err.Error(), 0xFF0000)
+					return
+				}
+				// The message is posted first so that a failure leaves no tournament behind
+				if err := postRegistration(s, tournament, i.ChannelID); err != nil {
+					sendInteractionResponse(s, i, "Erreur", err.Error(), 0xFF0000)
+					return
+				}
+				if err := openRegistration(db, tournament); err != nil {
+					if err := s.ChannelMessageDelete(i.ChannelID, tournament.Registration.MessageID); err != nil {
+						log.Printf("Error deleting sign-ups: %v", err)
+					}
+					sendInteractionResponse(s, i, "Erreur", "Error opening sign-ups: "+err.Error(), 0xFF0000)
+					return
+				}
+				sendEphemeralResponse(s, i, "Succès", fmt.Sprintf("Sign-ups are open for tournament %s", tournament.ID), 0x00FF00)
+				log.Print("Sign-ups opened successfully")
+
+			case "close":
+				if err := closeRegistration(db); err != nil {
+					sendInteractionResponse(s, i, "Erreur", "Error closing sign-ups: "+err.Error(), 0xFF0000)
+					return
+				}
+				refreshRegistration(s, getCurrentTournament(db))
+				tournament := getCurrentTournament(db)
+				sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Sign-ups closed for tournament %s with %d entrants", tournament.ID, len(tournament.Registration.Entrants)), 0x00FF00)
+				log.Print("Sign-ups closed successfully")
+
 			case "status":
 				status := getTournamentStatus(*db)
 				sendInteractionResponse(s, i, "Tournament status", status, 0x00FF00)
 				log.Print("Tournament status sent successfully")
 
+			case "standings":
+				tournament := getCurrentTournament(db)
+				if tournament == nil || pendingTournament(db) != nil {
+					sendInteractionResponse(s, i, "Erreur", "No tournaments in progress", 0xFF0000)
+					return
+				}
+				standings := ""
+				for p, phase := range tournament.Phases[:tournament.CurrentPhase+1] {
+					if len(phase.Pools) > 0 {
+						standings += fmt.Sprintf("**%s**\n", phase.Name) + formatStandings(tournament, p)
+					}
+				}
+				if standings == "" {
+					sendInteractionResponse(s, i, "Erreur", "This tournament has no pools", 0xFF0000)
+					return
+				}
+				sendInteractionResponse(s, i, "Standings", standings, 0x00FF00)
+				log.Print("Standings sent successfully")
+
 			case "next":
 				err := nextRound(db)
 				if err != nil {
@@ -1150,23 +2142,25 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 
 				tournament := getCurrentTournament(db)
 				if tournament.Status == TournamentStatusComplete {
-					lastRound := tournament.Rounds[len(tournament.Rounds)-1]
-					winner := lastRound.Matches[0].Winner
+					if hasStandings(currentPhase(tournament).Format) {
+						sendInteractionResponse(s, i, "Tournament over!", "The tournament is over! Final standings:\n\n"+formatStandings(tournament, tournament.CurrentPhase), 0x00FF00)
+						return
+					}
+					winner := tournamentWinner(tournament)
 					sendInteractionResponse(s, i, "Tournament over!", fmt.Sprintf("The tournament is over! The winner is : %s", winner), 0x00FF00)
 					return
 				}
 
 				currentRound := tournament.Rounds[tournament.CurrentRound]
 				var matchesInfo strings.Builder
-				matchesInfo.WriteString(fmt.Sprintf("Round %d:\n\n", tournament.CurrentRound+1))
+				matchesInfo.WriteString(fmt.Sprintf("%s:\n\n", roundName(currentRound)))
 
 				for _, match := range currentRound.Matches {
-					if match.Player2 == "" {
+					if match.Bye {
 						matchesInfo.WriteString(fmt.Sprintf("Match %s: %s passes automatically\n",
 							match.ID, match.Player1))
 					} else {
-						matchesInfo.WriteString(fmt.Sprintf("Match %s: %s vs %s (Table: %s)\n",
-							match.ID, match.Player1, match.Player2, match.TableID))
+						matchesInfo.WriteString(formatMatchStatus(match))
 					}
 				}
 
@@ -1175,13 +2169,35 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			}
 
 		case "match":
-			if len(groupCmd.Options) < 2 {
+			if len(groupCmd.Options) == 0 || len(groupCmd.Options[0].Options) < 2 {
 				sendInteractionResponse(s, i, "Erreur", "Match ID and winner required", 0xFF0000)
 				return
 			}
-			matchID := groupCmd.Options[0].StringValue()
-			winnerName := groupCmd.Options[1].StringValue()
-			err := updateMatchResult(db, matchID, winnerName)
+			subCmd := groupCmd.Options[0]
+			matchID := subCmd.Options[0].StringValue()
+			winnerName, err := winnerOption(db, data, subCmd.Options)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", err.Error(), 0xFF0000)
+				return
+			}
+			var score string
+			if opt := getOption(subCmd.Options, "score"); opt != nil {
+				score = opt.StringValue()
+			}
+			if subCmd.Name == "edit" {
+				// Edits that clear later results wait for a confirmation
+				var invalidated []Match
+				invalidated, err = requestMatchEdit(db, matchID, winnerName, score, interactionUser(i).Username)
+				if err == nil && len(invalidated) > 0 {
+					sendMatchEditConfirmation(s, i, *findMatch(getCurrentTournament(db), matchID), invalidated)
+					return
+				}
+				if err == nil {
+					_, err = correctMatchResult(db, matchID, winnerName, score)
+				}
+			} else {
+				err = updateMatchResult(db, matchID, winnerName, score)
+			}
 			if err != nil {
 				sendInteractionResponse(s, i, "Erreur", "Error updating results: "+err.Error(), 0xFF0000)
 				return
@@ -1192,6 +2208,233 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				status, 0x00FF00)
 			log.Print("Match updated successfully")
 
+		case "register":
+			user := interactionUser(i)
+			username := user.Username
+			if opt := getOption(groupCmd.Options, "username"); opt != nil {
+				username = opt.StringValue()
+			}
+			player, err := registerPlayer(db, user.ID, username)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error registering: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("<@%s> is registered as %s!", user.ID, player.Username), 0x00FF00)
+			log.Print("Player registered successfully")
+
+		case "report":
+			if len(groupCmd.Options) < 3 {
+				sendInteractionResponse(s, i, "Erreur", "Match ID, score and winner required", 0xFF0000)
+				return
+			}
+			matchID := groupCmd.Options[0].StringValue()
+			winnerName, err := winnerOption(db, data, groupCmd.Options)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", err.Error(), 0xFF0000)
+				return
+			}
+			err = submitReport(db, matchID, playerNameForUser(db, interactionUser(i)), winnerName, groupCmd.Options[1].StringValue(), i.ChannelID)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error reporting match: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendReportMessage(s, i, *findMatch(getCurrentTournament(db), matchID))
+			log.Print("Match reported successfully")
+
+		case "disputes":
+			sendInteractionResponse(s, i, "Disputes", formatDisputes(db), 0xFFFF00)
+			log.Print("Disputes sent successfully")
+
+		case "settings":
+			if len(groupCmd.Options) == 0 {
+				sendInteractionResponse(s, i, "Erreur", "Setting required", 0xFF0000)
+				return
+			}
+			minutes := int(groupCmd.Options[0].IntValue())
+			if err := setReportTimeout(db, minutes); err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error updating settings: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Unanswered reports are now confirmed after %d minutes", minutes), 0x00FF00)
+			log.Print("Settings updated successfully")
+
+		case "callouts":
+			var channelID string
+			if opt := getOption(groupCmd.Options, "channel"); opt != nil {
+				channelID = opt.ChannelValue(nil).ID
+			}
+			var minutes int
+			if opt := getOption(groupCmd.Options, "checkin_timeout"); opt != nil {
+				minutes = int(opt.IntValue())
+			}
+			if err := setCallouts(db, channelID, minutes); err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error updating call-outs: "+err.Error(), 0xFF0000)
+				return
+			}
+			if channelID == "" {
+				sendInteractionResponse(s, i, "Succès", "Matches are not called anymore", 0x00FF00)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Matches are now called in <#%s>, players who don't check in are pinged again every %d minutes",
+				channelID, int(checkInTimeout(db).Minutes())), 0x00FF00)
+			log.Print("Call-outs updated successfully")
+
+		case "threads":
+			var channelID string
+			if opt := getOption(groupCmd.Options, "channel"); opt != nil {
+				channelID = opt.ChannelValue(nil).ID
+			}
+			private := false
+			if opt := getOption(groupCmd.Options, "private"); opt != nil {
+				private = opt.BoolValue()
+			}
+			if err := setMatchThreads(db, channelID, private); err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error updating match threads: "+err.Error(), 0xFF0000)
+				return
+			}
+			if channelID == "" {
+				sendInteractionResponse(s, i, "Succès", "Threads are not opened for matches anymore", 0x00FF00)
+				return
+			}
+			kind := "public"
+			if private {
+				kind = "private"
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Each match being played now gets a %s thread under <#%s>", kind, channelID), 0x00FF00)
+			log.Print("Match threads updated successfully")
+
+		case "game":
+			if len(groupCmd.Options) < 2 {
+				sendInteractionResponse(s, i, "Erreur", "Match ID and winner required", 0xFF0000)
+				return
+			}
+			matchID := groupCmd.Options[0].StringValue()
+			winnerName := groupCmd.Options[1].StringValue()
+			game := Game{Winner: winnerName}
+			if opt := getOption(groupCmd.Options, "winner_character"); opt != nil {
+				game.WinnerCharacter = opt.StringValue()
+			}
+			if opt := getOption(groupCmd.Options, "loser_character"); opt != nil {
+				game.LoserCharacter = opt.StringValue()
+			}
+			if opt := getOption(groupCmd.Options, "stage"); opt != nil {
+				game.Stage = opt.StringValue()
+			}
+			if opt := getOption(groupCmd.Options, "stocks"); opt != nil {
+				game.Stocks = int(opt.IntValue())
+			}
+			err := recordGame(db, matchID, game)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error recording game: "+err.Error(), 0xFF0000)
+				return
+			}
+			match := findMatch(getCurrentTournament(db), matchID)
+			if match.Winner != "" {
+				sendInteractionResponse(s, i, "Success", getTournamentStatus(*db), 0x00FF00)
+				return
+			}
+			player1Wins, player2Wins := gameWins(*match)
+			sendStageSelection(s, i, discordgo.InteractionResponseChannelMessageWithSource,
+				fmt.Sprintf("Game %d recorded: %s %d - %d %s (Bo%d)", len(match.Games), match.Player1, player1Wins, player2Wins, match.Player2, match.BestOf),
+				getCurrentTournament(db), *match)
+			log.Print("Game recorded successfully")
+
+		case "stats":
+			var player string
+			if opt := getOption(groupCmd.Options, "player"); opt != nil {
+				player = opt.StringValue()
+			}
+			title := "Stats"
+			if player != "" {
+				title = "Stats - " + player
+			}
+			stats, err := formatStats(db, player)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error loading stats: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, title, stats, 0x00FF00)
+			log.Print("Stats sent successfully")
+
+		case "stages":
+			if len(groupCmd.Options) == 0 {
+				sendInteractionResponse(s, i, "Erreur", "Match ID required", 0xFF0000)
+				return
+			}
+			matchID := groupCmd.Options[0].StringValue()
+			if err := startStageSelection(db, matchID); err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error starting stage selection: "+err.Error(), 0xFF0000)
+				return
+			}
+			tournament := getCurrentTournament(db)
+			sendStageSelection(s, i, discordgo.InteractionResponseChannelMessageWithSource, "", tournament, *findMatch(tournament, matchID))
+			log.Print("Stage selection sent successfully")
+
+		case "ruleset":
+			starters := getOption(groupCmd.Options, "starters")
+			bans := getOption(groupCmd.Options, "bans")
+			if starters == nil || bans == nil {
+				sendInteractionResponse(s, i, "Erreur", "Starters and bans required", 0xFF0000)
+				return
+			}
+			counterpicks := ""
+			if opt := getOption(groupCmd.Options, "counterpicks"); opt != nil {
+				counterpicks = opt.StringValue()
+			}
+			dsr := true
+			if opt := getOption(groupCmd.Options, "dsr"); opt != nil {
+				dsr = opt.BoolValue()
+			}
+			err := setRuleset(db, starters.StringValue(), counterpicks, int(bans.IntValue()), dsr)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error updating ruleset: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", formatRuleset(tournamentRuleset(getCurrentTournament(db))), 0x00FF00)
+			log.Print("Ruleset updated successfully")
+
+		case "bestof":
+			if len(groupCmd.Options) < 2 {
+				sendInteractionResponse(s, i, "Erreur", "Round and number of games required", 0xFF0000)
+				return
+			}
+			roundID := groupCmd.Options[0].StringValue()
+			bestOf := int(groupCmd.Options[1].IntValue())
+			if err := setRoundBestOf(db, roundID, bestOf); err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error updating round: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Sets of round %s are now best of %d", roundID, bestOf), 0x00FF00)
+			log.Print("Round best-of updated successfully")
+
+		case "panels":
+			tournament := getCurrentTournament(db)
+			if tournament == nil {
+				sendInteractionResponse(s, i, "Erreur", "No active tournament", 0xFF0000)
+				return
+			}
+			ready := readyMatches(tournament)
+			if len(ready) == 0 {
+				sendInteractionResponse(s, i, "Erreur", "No match is being played", 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Posting %d match panels. Pick the score, then click the winner.", len(ready)), 0x00FF00)
+			postMatchPanels(s, i.ChannelID, ready)
+			log.Print("Match panels sent successfully")
+
+		case "undo":
+			event, err := undoLastEvent(db)
+			if err != nil {
+				sendInteractionResponse(s, i, "Erreur", "Error undoing: "+err.Error(), 0xFF0000)
+				return
+			}
+			sendInteractionResponse(s, i, "Succès", fmt.Sprintf("Undone: %s", event.Description), 0x00FF00)
+			log.Print("Undo sent successfully")
+
+		case "history":
+			sendInteractionResponse(s, i, "History", formatHistory(db, 15), 0x00FF00)
+			log.Print("History sent successfully")
+
 		case "clear":
 			if len(groupCmd.Options) == 0 {
 				sendInteractionResponse(s, i, "Erreur", "Type of cleaning required", 0xFF0000)
@@ -1203,24 +2446,24 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			case "tournament":
 
 				sendInteractionResponse(s, i, "Security code",
-					fmt.Sprintf("To confirm the deletion of tournaments, use the command `/smashbot confirm-clear %05d`", generateSecurityCode("tournament")),
+					fmt.Sprintf("To confirm the deletion of tournaments, use the command `/smashbot-admin confirm-clear %05d`", generateSecurityCode(i.GuildID, "tournament")),
 					0xFFFF00)
 				return
 			case "player":
 
 				sendInteractionResponse(s, i, "Security code",
-					fmt.Sprintf("To confirm the deletion of the player, use the command `/smashbot confirm-clear %05d`", generateSecurityCode("player")),
+					fmt.Sprintf("To confirm the deletion of the player, use the command `/smashbot-admin confirm-clear %05d`", generateSecurityCode(i.GuildID, "player")),
 					0xFFFF00)
 				return
 			case "tables":
 
 				sendInteractionResponse(s, i, "Security code",
-					fmt.Sprintf("To confirm the deletion of the table, use the command `/smashbot confirm-clear %05d`", generateSecurityCode("tables")),
+					fmt.Sprintf("To confirm the deletion of the table, use the command `/smashbot-admin confirm-clear %05d`", generateSecurityCode(i.GuildID, "tables")),
 					0xFFFF00)
 				return
 			case "ALL":
 				sendInteractionResponse(s, i, "Security code",
-					fmt.Sprintf("To confirm the deletion of the database, use the command `/smashbot confirm-clear %05d type: ALL`", generateSecurityCode("ALL")), // Changé "database" en "ALL"
+					fmt.Sprintf("To confirm the deletion of the database, use the command `/smashbot-admin confirm-clear %05d type: ALL`", generateSecurityCode(i.GuildID, "ALL")), // Changé "database" en "ALL"
 					0xFFFF00)
 				return
 			}
@@ -1237,7 +2480,7 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 			securityCode := int(groupCmd.Options[0].IntValue())
 			clearType := groupCmd.Options[1].StringValue()
 
-			if err := verifySecurityCode(clearType, strconv.Itoa(securityCode)); err != nil {
+			if err := verifySecurityCode(i.GuildID, clearType, strconv.Itoa(securityCode)); err != nil {
 				sendInteractionResponse(s, i, "Erreur", fmt.Sprintf("Incorrect security code for %s: %v", clearType, err), 0xFF0000)
 				return
 			}
@@ -1247,6 +2490,8 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				successMsg string
 			)
 			log.Print(successMsg)
+			// Threads of the cleared matches go with them
+			threads := matchThreads(db)
 			switch clearType {
 			case "tournament":
 				err = clearTournament(db)
@@ -1271,6 +2516,9 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 				return
 			}
 			sendInteractionResponse(s, i, "Success", successMsg, 0x00FF00)
+			if clearType == "tournament" || clearType == "ALL" {
+				deleteMatchThreads(s, threads)
+			}
 			log.Print("Tournaments cleared successfully")
 		}
 
@@ -1279,26 +2527,50 @@ func handleCommands(s *discordgo.Session, i *discordgo.InteractionCreate) {
 **SmashBot Commands**
 
 *Tournament Management*
-- /smashbot tournament start - Start a new tournament
-- /smashbot tournament next - Move to next round
+- /smashbot tournament open - Open sign-ups with Join/Leave buttons, an optional cap and closing time
+- /smashbot tournament close - Close sign-ups
+- /smashbot tournament start - Start a new tournament (format: double/single elimination, round robin pools or Swiss)
+- /smashbot tournament next - Move to next round or phase
 - /smashbot tournament status - Display current tournament status
+- /smashbot tournament standings - Display pool or Swiss standings
 
 *Match Management*
-- /smashbot match - Update match results with winner
+- /smashbot match result - Record the winner and set score of a match
+- /smashbot match edit - Change the winner or score of a finished match
+- /smashbot panels - Post a panel for each match being played, to report results with buttons
+- /smashbot undo - Revert the latest change to players, tables or tournaments
+- /smashbot history - Display the latest changes and who made them
+- /smashbot report - Report your own set, your opponent confirms or disputes it
+- /smashbot disputes - List disputed results waiting for an organizer
+- /smashbot game - Record a single game of a set, with characters, stage and stocks
+- /smashbot stages - Strike or counterpick the stage of the next game with buttons
+- /smashbot ruleset - Set the starter and counterpick stages and the number of bans
+- /smashbot stats - Display the most played characters and stage win rates
+- /smashbot bestof - Set the number of games of a round (Bo3 by default, Bo5 from top 8)
 
 *Player Management*
-- /smashbot add player - Add new player to database
+- /smashbot add player - Add new player to database, optionally linked to a Discord account
+- /smashbot register - Register yourself as a player
 - /smashbot remove player - Remove player from database
 - /smashbot list player - Display all registered players
+- /smashbot seed - Set the seed or rating of a player
 
 *Table Management*
 - /smashbot add tables - Add tables to venue
 - /smashbot remove tables - Remove tables from venue
 - /smashbot list table - Display all available tables
 
-*Database Management*
-- /smashbot clear - Clear specified data (tournament/player/table/ALL)
-- /smashbot confirm-clear - Confirm clearing with security code
+*Administration* (admin role, allowed for the role in Server Settings > Integrations)
+- /smashbot-admin clear - Clear specified data (tournament/player/table/ALL)
+- /smashbot-admin confirm-clear - Confirm clearing with security code
+- /smashbot-admin server - Start or stop serving this server's bracket on the web server
+- /smashbot-admin claim - Move the data saved before multi-server support to this server
+- /smashbot-admin settings - Set the minutes before an unanswered report is confirmed
+- /smashbot-admin callouts - Call ready matches in a channel and ping players who don't check in
+- /smashbot-admin threads - Open a thread for each match being played
+- /smashbot-admin roles - Set the organizer and admin roles
+
+Players can run the read-only commands, register, report, stages and stats. Everything else needs the organizer role.
 
 For more details about specific commands, use them directly to see options and requirements.`
 
@@ -1309,6 +2581,17 @@ For more details about specific commands, use them directly to see options and r
 }
 
 func main() {
+	dryRun := flag.Bool("migrate-dry-run", false, "print what migrating database.json would change and exit")
+	flag.Parse()
+	if *dryRun {
+		report, err := migrationReport("database.json")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(report)
+		return
+	}
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
@@ -1319,6 +2602,12 @@ func main() {
 		log.Fatal("Bot token not defined in .env file")
 	}
 
+	dataStore, err = openStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer dataStore.Close()
+
 	sess, err := discordgo.New("Bot " + token)
 	if err != nil {
 		log.Fatal(err)
@@ -1340,6 +2629,10 @@ func main() {
 
 	log.Print("Bot is running")
 
+	stopTimers := make(chan struct{})
+	defer close(stopTimers)
+	go runTimers(sess, stopTimers)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/tournament", serveTournamentData)
 	mux.Handle("/", http.FileServer(http.Dir("public")))
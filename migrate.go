@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Version of the layout of the database file written by this version of the bot
+const currentSchemaVersion = 3
+
+// Returned for files written by a newer version of the bot, which must not be
+// replaced by an older snapshot
+var errNewerSchema = errors.New("database was written by a newer version of the bot")
+
+// Upgrade of the database file to a version from the one before it. Migrations
+// work on the raw JSON so they do not depend on the current Go types.
+type migration struct {
+	Version     int
+	Description string
+	// Changes the content of the file and returns what it changed
+	Apply func(data map[string]any) ([]string, error)
+}
+
+// Every migration, in version order. A model change that breaks existing files
+// bumps currentSchemaVersion and adds its migration here.
+var migrations = []migration{
+	{Version: 1, Description: "keep each server's data under its guild ID", Apply: migrateGuildLayout},
+	{Version: 2, Description: "rename the tournament list of each server to tournaments", Apply: migrateTournamentsKey},
+	{Version: 3, Description: "wrap tournaments saved before phases in a phase and link baseline brackets", Apply: migrateLegacyTournaments},
+}
+
+// Returns the schema version of the content of a file. Files written before it
+// was recorded are version 1 when they have a guilds map, 0 otherwise.
+func schemaVersion(data map[string]any) int {
+	if version, ok := data["schema_version"].(float64); ok {
+		return int(version)
+	}
+	if _, ok := data["guilds"]; ok {
+		return 1
+	}
+	return 0
+}
+
+// Upgrades the content of a file to the current version and returns the changes made
+func migrate(data map[string]any) ([]string, error) {
+	version := schemaVersion(data)
+	if version > currentSchemaVersion {
+		return nil, fmt.Errorf("%w: version %d, this bot reads up to %d", errNewerSchema, version, currentSchemaVersion)
+	}
+	var changes []string
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+		details, err := m.Apply(data)
+		if err != nil {
+			return nil, fmt.Errorf("error migrating database to version %d: %w", m.Version, err)
+		}
+		data["schema_version"] = float64(m.Version)
+		changes = append(changes, fmt.Sprintf("Version %d: %s", m.Version, m.Description))
+		for _, detail := range details {
+			changes = append(changes, "  - "+detail)
+		}
+	}
+	return changes, nil
+}
+
+// Returns the servers of the content of a file, in a stable order
+func migrationGuilds(data map[string]any) (map[string]any, []string, error) {
+	guilds, ok := data["guilds"].(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("guilds is not an object")
+	}
+	ids := make([]string, 0, len(guilds))
+	for id := range guilds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return guilds, ids, nil
+}
+
+// Version 1: files written before multi-server support hold a single server's
+// data at the top level. It moves under the legacy key, until an admin claims
+// it for their server.
+func migrateGuildLayout(data map[string]any) ([]string, error) {
+	legacy := make(map[string]any)
+	count := make(map[string]int)
+	for _, key := range []string{"players", "tables", "tournament", "settings"} {
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+		legacy[key] = value
+		delete(data, key)
+		if list, ok := value.([]any); ok {
+			count[key] = len(list)
+		}
+	}
+
+	guilds := make(map[string]any)
+	data["guilds"] = guilds
+	if count["players"] == 0 && count["tables"] == 0 && count["tournament"] == 0 {
+		return []string{"no server data to move"}, nil
+	}
+	guilds[legacyGuildID] = legacy
+	return []string{fmt.Sprintf("%d players, %d tables and %d tournaments kept for the first server that uses the bot",
+		count["players"], count["tables"], count["tournament"])}, nil
+}
+
+// Version 2: the tournaments of a server were saved under "tournament"
+func migrateTournamentsKey(data map[string]any) ([]string, error) {
+	guilds, ids, err := migrationGuilds(data)
+	if err != nil {
+		return nil, err
+	}
+	var details []string
+	for _, id := range ids {
+		guild, ok := guilds[id].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("guild %s is not an object", id)
+		}
+		tournaments, ok := guild["tournament"]
+		if !ok {
+			continue
+		}
+		delete(guild, "tournament")
+		guild["tournaments"] = tournaments
+		list, _ := tournaments.([]any)
+		details = append(details, fmt.Sprintf("guild %s: %d tournaments renamed", id, len(list)))
+	}
+	return details, nil
+}
+
+// Version 3: tournaments saved before phases existed have none, and the format
+// and pools they had are moved to a single phase. Baseline brackets only linked
+// matches through their IDs and a "classe" field, so their links are rebuilt.
+func migrateLegacyTournaments(data map[string]any) ([]string, error) {
+	guilds, ids, err := migrationGuilds(data)
+	if err != nil {
+		return nil, err
+	}
+	var details []string
+	for _, id := range ids {
+		guild, ok := guilds[id].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("guild %s is not an object", id)
+		}
+		tournaments, _ := guild["tournaments"].([]any)
+		for _, t := range tournaments {
+			tournament, ok := t.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("guild %s: tournament is not an object", id)
+			}
+			if phases, _ := tournament["phases"].([]any); len(phases) > 0 {
+				continue
+			}
+			format, err := wrapLegacyTournament(tournament)
+			if err != nil {
+				return nil, fmt.Errorf("guild %s: %w", id, err)
+			}
+			details = append(details, fmt.Sprintf("guild %s: tournament %v wrapped in a %s phase", id, tournament["id"], format))
+		}
+	}
+	return details, nil
+}
+
+// Returns the rounds of a tournament and their matches as raw JSON objects
+func legacyRounds(tournament map[string]any) ([]map[string]any, [][]map[string]any, error) {
+	list, _ := tournament["rounds"].([]any)
+	rounds := make([]map[string]any, len(list))
+	matches := make([][]map[string]any, len(list))
+	for r, value := range list {
+		round, ok := value.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("tournament %v: round is not an object", tournament["id"])
+		}
+		rounds[r] = round
+		roundMatches, _ := round["matches"].([]any)
+		for _, m := range roundMatches {
+			match, ok := m.(map[string]any)
+			if !ok {
+				return nil, nil, fmt.Errorf("tournament %v: match is not an object", tournament["id"])
+			}
+			matches[r] = append(matches[r], match)
+		}
+	}
+	return rounds, matches, nil
+}
+
+// Moves a tournament saved before phases into a single phase and returns its format
+func wrapLegacyTournament(tournament map[string]any) (string, error) {
+	rounds, matches, err := legacyRounds(tournament)
+	if err != nil {
+		return "", err
+	}
+
+	format, _ := tournament["format"].(string)
+	linked := false
+	for _, roundMatches := range matches {
+		for _, match := range roundMatches {
+			// Baseline matches kept their side of the bracket in "classe"
+			if classe, ok := match["classe"].(string); ok {
+				if bracket, _ := match["bracket"].(string); bracket == "" {
+					match["bracket"] = legacyBracketSide(classe)
+				}
+				delete(match, "classe")
+			}
+			if next, _ := match["next_match_id"].(string); next != "" {
+				linked = true
+			}
+			if format == "" {
+				switch match["bracket"] {
+				case "losers", "grand_finals":
+					format = "double_elimination"
+				case "pools":
+					format = "round_robin"
+				}
+			}
+		}
+	}
+	if format == "" {
+		format = "single_elimination"
+	}
+	if !linked && format == "single_elimination" {
+		rounds, matches = linkBaselineBracket(rounds, matches)
+	}
+
+	currentRound := len(rounds) - 1
+	for r, round := range rounds {
+		round["phase"] = float64(0)
+		if id, _ := round["id"].(string); id == "" {
+			round["id"] = fmt.Sprintf("R%d", r+1)
+			round["number"] = float64(r + 1)
+			round["bracket"] = "winners"
+		}
+		list := make([]any, len(matches[r]))
+		for m, match := range matches[r] {
+			list[m] = match
+			if winner, _ := match["winner"].(string); winner == "" && r < currentRound {
+				currentRound = r
+			}
+		}
+		round["matches"] = list
+	}
+	list := make([]any, len(rounds))
+	for r, round := range rounds {
+		list[r] = round
+	}
+	tournament["rounds"] = list
+	if currentRound < 0 {
+		currentRound = 0
+	}
+	tournament["current_round"] = float64(currentRound)
+	reserveLegacyTables(tournament, matches)
+
+	status, _ := tournament["status"].(string)
+	if status != "complete" {
+		status = "ongoing"
+	}
+	name := "Bracket"
+	if format == "round_robin" {
+		name = "Pools"
+	}
+	tournament["phases"] = []any{map[string]any{
+		"name":   name,
+		"format": format,
+		"pools":  tournament["pools"],
+		"status": status,
+	}}
+	tournament["current_phase"] = float64(0)
+	delete(tournament, "format")
+	delete(tournament, "pools")
+	return format, nil
+}
+
+// Returns the side of the bracket a baseline "classe" stood for
+func legacyBracketSide(classe string) string {
+	switch strings.ToLower(classe) {
+	case "losers", "loser":
+		return "losers"
+	case "grand_finals", "grand finals", "final":
+		return "grand_finals"
+	}
+	return "winners"
+}
+
+// Rebuilds the links of a baseline single elimination bracket. Baseline rounds
+// were only created once the matches feeding them were over: match M of a round
+// fed match (M+1)/2 of the next one, and a round with an odd number of matches
+// gave its last winner a bye. Every round is created, each match is linked to the
+// next one and the winners not moved forward yet are placed.
+func linkBaselineBracket(rounds []map[string]any, matches [][]map[string]any) ([]map[string]any, [][]map[string]any) {
+	if len(matches) == 0 || len(matches[0]) == 0 {
+		return rounds, matches
+	}
+	byID := make(map[string]map[string]any)
+	for _, roundMatches := range matches {
+		for _, match := range roundMatches {
+			id, _ := match["id"].(string)
+			byID[id] = match
+		}
+	}
+
+	sizes := []int{len(matches[0])}
+	for sizes[len(sizes)-1] > 1 {
+		sizes = append(sizes, (sizes[len(sizes)-1]+1)/2)
+	}
+	linkedRounds := make([]map[string]any, len(sizes))
+	linkedMatches := make([][]map[string]any, len(sizes))
+	for r, size := range sizes {
+		if r < len(rounds) {
+			linkedRounds[r] = rounds[r]
+		} else {
+			linkedRounds[r] = map[string]any{}
+		}
+		for m := 1; m <= size; m++ {
+			id := fmt.Sprintf("R%dM%d", r+1, m)
+			match := byID[id]
+			if match == nil {
+				match = map[string]any{"id": id, "player1": "", "player2": "", "winner": ""}
+				byID[id] = match
+			}
+			match["bracket"] = "winners"
+			if r+1 < len(sizes) {
+				match["next_match_id"] = fmt.Sprintf("R%dM%d", r+2, (m+1)/2)
+				match["next_match_slot"] = float64(2 - m%2)
+			}
+			player2, _ := match["player2"].(string)
+			winner, _ := match["winner"].(string)
+			switch {
+			case r == 0:
+				match["bye"] = player2 == "" && winner != ""
+			default:
+				// The second slot of the last match of a round after an odd one is never filled
+				match["bye"] = 2*m > sizes[r-1]
+			}
+			linkedMatches[r] = append(linkedMatches[r], match)
+		}
+	}
+
+	// Winners move forward round by round, byes are won as soon as their player arrives
+	for _, roundMatches := range linkedMatches {
+		for _, match := range roundMatches {
+			player1, _ := match["player1"].(string)
+			winner, _ := match["winner"].(string)
+			if match["bye"] == true && player1 != "" && winner == "" {
+				winner = player1
+				match["winner"] = winner
+			}
+			next, _ := match["next_match_id"].(string)
+			if winner == "" || next == "" {
+				continue
+			}
+			slot := "player1"
+			if match["next_match_slot"] == float64(2) {
+				slot = "player2"
+			}
+			if placed, _ := byID[next][slot].(string); placed == "" {
+				byID[next][slot] = winner
+			}
+		}
+	}
+	return linkedRounds, linkedMatches
+}
+
+// Marks the tables of a migrated tournament used by the matches being played
+// on them. Baseline tables were handed out in turn and could be given twice, a
+// match whose table is taken gets a free one when tables are next assigned.
+func reserveLegacyTables(tournament map[string]any, matches [][]map[string]any) {
+	tables, _ := tournament["tables"].([]any)
+	byID := make(map[string]map[string]any)
+	for _, t := range tables {
+		if table, ok := t.(map[string]any); ok {
+			table["available"] = true
+			table["match_id"] = ""
+			if id, _ := table["id"].(string); id != "" {
+				byID[id] = table
+			}
+		}
+	}
+	for _, roundMatches := range matches {
+		for _, match := range roundMatches {
+			player1, _ := match["player1"].(string)
+			player2, _ := match["player2"].(string)
+			winner, _ := match["winner"].(string)
+			tableID, _ := match["table_id"].(string)
+			if tableID == "" {
+				continue
+			}
+			table := byID[tableID]
+			if player1 == "" || player2 == "" || winner != "" || table == nil || table["available"] == false {
+				if winner == "" {
+					match["table_id"] = ""
+				}
+				continue
+			}
+			table["available"] = false
+			table["match_id"] = match["id"]
+		}
+	}
+}
+
+// Parses the content of a database file, migrating it in memory when it is
+// older than the current version. Returns the version it was written with.
+func parseStorage(file []byte) (*Storage, int, error) {
+	var data map[string]any
+	if err := json.Unmarshal(file, &data); err != nil {
+		return nil, 0, err
+	}
+	version := schemaVersion(data)
+	if version != currentSchemaVersion {
+		if _, err := migrate(data); err != nil {
+			return nil, version, err
+		}
+		var err error
+		if file, err = json.Marshal(data); err != nil {
+			return nil, version, err
+		}
+	}
+
+	storage := &Storage{}
+	if err := json.Unmarshal(file, storage); err != nil {
+		return nil, version, err
+	}
+	if storage.Guilds == nil {
+		storage.Guilds = make(map[string]*Database)
+	}
+	return storage, version, nil
+}
+
+// Describes what migrating a database file would change, without writing anything
+func migrationReport(path string) (string, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading database file: %w", err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(file, &data); err != nil {
+		return "", fmt.Errorf("error unmarshalling database: %w", err)
+	}
+	version := schemaVersion(data)
+	if version == currentSchemaVersion {
+		return fmt.Sprintf("%s is up to date (schema version %d).", path, version), nil
+	}
+	changes, err := migrate(data)
+	if err != nil {
+		return "", err
+	}
+	result := fmt.Sprintf("%s is at schema version %d, migrating to version %d would:\n", path, version, currentSchemaVersion)
+	for _, change := range changes {
+		result += change + "\n"
+	}
+	result += fmt.Sprintf("A backup would be saved as %s before migrating.", migrationBackupPath(path, version))
+	return result, nil
+}
+
+// Returns the path of the copy of a file taken before migrating it from a version
+func migrationBackupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// Database file written by the first version of the bot: a single server at the
+// top level, tournaments under "tournament" and matches linked only by their IDs
+const baselineDatabase = `{
+  "players": [
+    {"id": "1", "username": "alice"},
+    {"id": "2", "username": "bob"},
+    {"id": "3", "username": "carol"},
+    {"id": "4", "username": "dave"},
+    {"id": "5", "username": "erin"}
+  ],
+  "tables": [{"id": "0", "available": true, "match_id": ""}, {"id": "1", "available": true, "match_id": ""}],
+  "tournament": [
+    {
+      "id": "1",
+      "rounds": [
+        {"matches": [
+          {"id": "R1M1", "player1": "alice", "player2": "bob", "winner": "alice", "table_id": "0", "classe": "", "next_match_id": ""},
+          {"id": "R1M2", "player1": "carol", "player2": "", "winner": "carol", "table_id": "", "classe": "", "next_match_id": ""}
+        ]},
+        {"matches": [
+          {"id": "R2M1", "player1": "alice", "player2": "carol", "winner": "", "table_id": "1", "classe": "", "next_match_id": ""}
+        ]}
+      ],
+      "player_ids": ["alice", "bob", "carol"],
+      "status": "ongoing",
+      "current_round": 1,
+      "is_first_round": true,
+      "tables": [{"id": "0", "available": true, "match_id": ""}, {"id": "1", "available": true, "match_id": ""}]
+    },
+    {
+      "id": "2",
+      "rounds": [
+        {"matches": [
+          {"id": "R1M1", "player1": "alice", "player2": "bob", "winner": "alice", "table_id": "0", "classe": "", "next_match_id": ""},
+          {"id": "R1M2", "player1": "carol", "player2": "dave", "winner": "", "table_id": "1", "classe": "", "next_match_id": ""},
+          {"id": "R1M3", "player1": "erin", "player2": "", "winner": "erin", "table_id": "", "classe": "", "next_match_id": ""}
+        ]}
+      ],
+      "player_ids": ["alice", "bob", "carol", "dave", "erin"],
+      "status": "ongoing",
+      "current_round": 0,
+      "is_first_round": true,
+      "tables": [{"id": "0", "available": true, "match_id": ""}, {"id": "1", "available": true, "match_id": ""}]
+    }
+  ]
+}`
+
+func TestLoadBaselineDatabase(t *testing.T) {
+	useTestStore(t)
+	if err := os.WriteFile("database.json", []byte(baselineDatabase), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if len(db.Tournaments) != 0 {
+		t.Fatal("the baseline data went to a server before it was claimed")
+	}
+	if err := claimLegacyData(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Tournaments) != 2 {
+		t.Fatalf("expected 2 tournaments, got %d", len(db.Tournaments))
+	}
+	if status := getTournamentStatus(*db); !strings.Contains(status, "R1M2") {
+		t.Errorf("status does not show the match being played:\n%s", status)
+	}
+
+	first := db.Tournaments[0]
+	if len(first.Phases) != 1 || first.Phases[0].Format != FormatSingleElimination {
+		t.Fatalf("expected a single elimination phase, got %+v", first.Phases)
+	}
+	if final := findMatch(&first, "R2M1"); final == nil || !isMatchReady(*final) {
+		t.Errorf("the final of the first tournament should still be playable: %+v", final)
+	}
+
+	// The winners of the current tournament were not moved forward yet
+	tournament := getCurrentTournament(db)
+	for id, want := range map[string]string{"R1M1": "R2M1", "R1M2": "R2M1", "R1M3": "R2M2", "R2M1": "R3M1", "R2M2": "R3M1"} {
+		if match := findMatch(tournament, id); match == nil || match.NextmatchID != want {
+			t.Errorf("match %s should lead to %s: %+v", id, want, match)
+		}
+	}
+	if bye := findMatch(tournament, "R2M2"); !bye.Bye || bye.Winner != "erin" {
+		t.Errorf("erin should pass through R2M2 as a bye: %+v", bye)
+	}
+	if err := updateMatchResult(db, "R1M2", "carol", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateMatchResult(db, "R2M1", "carol", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateMatchResult(db, "R3M1", "erin", ""); err != nil {
+		t.Fatal(err)
+	}
+	if tournament := getCurrentTournament(db); tournament.Status != TournamentStatusComplete || tournamentWinner(tournament) != "erin" {
+		t.Errorf("expected erin to win the migrated tournament, got %s (%s)", tournamentWinner(tournament), tournament.Status)
+	}
+}
+
+func TestClaimLegacyData(t *testing.T) {
+	useTestStore(t)
+	if err := os.WriteFile("database.json", []byte(baselineDatabase), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A server with players of its own can't take the legacy data
+	other, unlock, err := state.acquire("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addPlayer(other, Player{ID: "1", Username: "zoe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := claimLegacyData(other); err == nil {
+		t.Error("a server with data claimed the legacy data")
+	}
+	unlock()
+
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if err := claimLegacyData(db); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err := state.snapshot("guild"); err != nil || len(saved.Tournaments) != 2 {
+		t.Errorf("claimed data was not published: %v", err)
+	}
+	if err := claimLegacyData(db); err == nil {
+		t.Error("the legacy data was claimed twice")
+	}
+}
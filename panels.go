@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Prefix of the custom ID of report panel components, followed by the action and the match ID
+const panelPrefix = "panel"
+
+// Returns the scores a set can end with, from the winner's side
+func setScores(match Match) []string {
+	if match.BestOf == 0 {
+		return nil
+	}
+	var scores []string
+	for loserGames := 0; loserGames < gamesToWin(match); loserGames++ {
+		scores = append(scores, fmt.Sprintf("%d-%d", gamesToWin(match), loserGames))
+	}
+	return scores
+}
+
+// Returns the description and components of the report panel of a match, with
+// the chosen score selected in the menu
+func matchPanel(match Match, score string) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	description := fmt.Sprintf("%s vs %s", match.Player1, match.Player2)
+	if match.BestOf > 0 {
+		description += fmt.Sprintf(" - Best of %d", match.BestOf)
+	}
+	if match.TableID != "" {
+		description += fmt.Sprintf("\nTable: %s", match.TableID)
+	}
+	description += "\n\nPick the score, then click the winner."
+	embed := &discordgo.MessageEmbed{
+		Title:       "Match " + match.ID,
+		Description: description,
+		Color:       0x00FF00,
+	}
+
+	var components []discordgo.MessageComponent
+	if scores := setScores(match); len(scores) > 0 {
+		menu := discordgo.SelectMenu{
+			CustomID:    fmt.Sprintf("%s:score:%s", panelPrefix, match.ID),
+			Placeholder: "Score",
+		}
+		for _, s := range scores {
+			menu.Options = append(menu.Options, discordgo.SelectMenuOption{Label: s, Value: s, Default: s == score})
+		}
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}})
+	}
+	components = append(components, discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    match.Player1,
+				Style:    discordgo.PrimaryButton,
+				CustomID: fmt.Sprintf("%s:player1:%s", panelPrefix, match.ID),
+			},
+			discordgo.Button{
+				Label:    match.Player2,
+				Style:    discordgo.PrimaryButton,
+				CustomID: fmt.Sprintf("%s:player2:%s", panelPrefix, match.ID),
+			},
+			discordgo.Button{
+				Label:    "Other result",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("%s:other:%s", panelPrefix, match.ID),
+			},
+		},
+	})
+	return embed, components
+}
+
+// Returns the ready matches of the current tournament
+func readyMatches(tournament *Tournament) []Match {
+	var ready []Match
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			if isMatchReady(match) {
+				ready = append(ready, match)
+			}
+		}
+	}
+	return ready
+}
+
+// Posts a report panel for each match in a channel
+func postMatchPanels(s *discordgo.Session, channelID string, matches []Match) {
+	for _, match := range matches {
+		embed, components := matchPanel(match, "")
+		_, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		})
+		if err != nil {
+			log.Printf("Error sending match panel: %v", err)
+		}
+	}
+}
+
+// Returns the score selected in the menu of the panel an interaction comes from
+func selectedScore(message *discordgo.Message) string {
+	if message == nil {
+		return ""
+	}
+	for _, row := range message.Components {
+		actions, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range actions.Components {
+			menu, ok := component.(*discordgo.SelectMenu)
+			if !ok {
+				continue
+			}
+			for _, option := range menu.Options {
+				if option.Default {
+					return option.Value
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Handles the components of a report panel: the score menu, the winner buttons
+// and the button opening the form for other results
+func handlePanelComponent(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, action string, matchID string) {
+	tournament := getCurrentTournament(db)
+	var match *Match
+	if tournament != nil {
+		match = findMatch(tournament, matchID)
+	}
+	if match == nil || !isMatchReady(*match) {
+		sendEphemeralResponse(s, i, "Erreur", "This match is not being played anymore", 0xFF0000)
+		return
+	}
+
+	switch action {
+	case "score":
+		values := i.MessageComponentData().Values
+		if len(values) == 0 {
+			return
+		}
+		embed, components := matchPanel(*match, values[0])
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Embeds:     []*discordgo.MessageEmbed{embed},
+				Components: components,
+			},
+		})
+		if err != nil {
+			log.Printf("Error updating match panel: %v", err)
+		}
+	case "player1", "player2":
+		winner := match.Player1
+		if action == "player2" {
+			winner = match.Player2
+		}
+		reportFromPanel(s, i, db, *match, winner, selectedScore(i.Message))
+	case "other":
+		sendResultModal(s, i, *match)
+	}
+}
+
+// Opens the form to type the winner and the score of a match
+func sendResultModal(s *discordgo.Session, i *discordgo.InteractionCreate, match Match) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: fmt.Sprintf("%s:modal:%s", panelPrefix, match.ID),
+			Title:    "Result of match " + match.ID,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "winner",
+							Label:       "Winner",
+							Style:       discordgo.TextInputShort,
+							Placeholder: match.Player1 + " or " + match.Player2,
+							Required:    true,
+						},
+					},
+				},
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "score",
+							Label:       "Score from the winner's side",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "2-1",
+							Required:    false,
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending result form: %v", err)
+	}
+}
+
+// Returns the value of a text input of a submitted form
+func modalValue(data discordgo.ModalSubmitInteractionData, customID string) string {
+	for _, row := range data.Components {
+		actions, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, component := range actions.Components {
+			if input, ok := component.(*discordgo.TextInput); ok && input.CustomID == customID {
+				return strings.TrimSpace(input.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// Handles the result form of a report panel
+func handlePanelModal(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, matchID string) {
+	tournament := getCurrentTournament(db)
+	var match *Match
+	if tournament != nil {
+		match = findMatch(tournament, matchID)
+	}
+	if match == nil || !isMatchReady(*match) {
+		sendEphemeralResponse(s, i, "Erreur", "This match is not being played anymore", 0xFF0000)
+		return
+	}
+	data := i.ModalSubmitData()
+	winner, ok := matchPlayerName(*match, modalValue(data, "winner"))
+	if !ok {
+		sendEphemeralResponse(s, i, "Erreur", fmt.Sprintf("The winner must be one of the players in the match: %s ou %s", match.Player1, match.Player2), 0xFF0000)
+		return
+	}
+	reportFromPanel(s, i, db, *match, winner, modalValue(data, "score"))
+}
+
+// Records a result picked on a panel. Organizers record it right away, like
+// /smashbot match result; players of the match report it for their opponent to confirm.
+func reportFromPanel(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, match Match, winner string, score string) {
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+
+	if memberLevel(db, i) < LevelOrganizer {
+		if score == "" {
+			sendEphemeralResponse(s, i, "Erreur", "Pick the score before the winner", 0xFF0000)
+			return
+		}
+		err := submitReport(db, match.ID, playerNameForUser(db, user), winner, score, i.ChannelID)
+		if err != nil {
+			sendEphemeralResponse(s, i, "Erreur", "Error reporting match: "+err.Error(), 0xFF0000)
+			return
+		}
+		sendReportMessage(s, i, *findMatch(getCurrentTournament(db), match.ID))
+		log.Print("Match reported from panel successfully")
+		return
+	}
+
+	tournament := getCurrentTournament(db)
+	readyBefore := make(map[string]bool)
+	for _, m := range readyMatches(tournament) {
+		readyBefore[m.ID] = true
+	}
+	if err := updateMatchResult(db, match.ID, winner, score); err != nil {
+		sendEphemeralResponse(s, i, "Erreur", "Error updating results: "+err.Error(), 0xFF0000)
+		return
+	}
+
+	description := fmt.Sprintf("%s vs %s\n**%s** wins", match.Player1, match.Player2, winner)
+	if score != "" {
+		description += " " + score
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Match " + match.ID,
+					Description: description,
+					Color:       0x00FF00,
+				},
+			},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Printf("Error updating match panel: %v", err)
+	}
+
+	// Matches the result made ready get their own panel, in their thread when matches have one
+	if db.Settings.ThreadChannel != "" {
+		log.Print("Match updated from panel successfully")
+		return
+	}
+	var newlyReady []Match
+	for _, m := range readyMatches(getCurrentTournament(db)) {
+		if !readyBefore[m.ID] {
+			newlyReady = append(newlyReady, m)
+		}
+	}
+	postMatchPanels(s, i.ChannelID, newlyReady)
+	log.Print("Match updated from panel successfully")
+}
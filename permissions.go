@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Level of trust needed to run a command
+type PermissionLevel int
+
+const (
+	LevelPlayer PermissionLevel = iota
+	LevelOrganizer
+	LevelAdmin
+)
+
+// Roles of a server allowed to run organizer and admin commands
+type GuildRoles struct {
+	OrganizerRole string `json:"organizer_role"`
+	AdminRole     string `json:"admin_role"`
+}
+
+// Commands players can run: read-only ones and the ones acting on their own matches
+var playerCommands = map[string]bool{
+	"list":     true,
+	"help":     true,
+	"register": true,
+	"report":   true,
+	"stages":   true,
+	"stats":    true,
+}
+
+// Tournament actions players can run
+var playerTournamentActions = map[string]bool{
+	"status":    true,
+	"standings": true,
+}
+
+// Commands that change or delete data of the whole server
+var adminCommands = map[string]bool{
+	"clear":         true,
+	"confirm-clear": true,
+	"server":        true,
+	"claim":         true,
+	"roles":         true,
+	"settings":      true,
+	"callouts":      true,
+	"threads":       true,
+}
+
+// Returns the level needed to run a subcommand
+func commandLevel(command *discordgo.ApplicationCommandInteractionDataOption) PermissionLevel {
+	switch {
+	case adminCommands[command.Name]:
+		return LevelAdmin
+	case playerCommands[command.Name]:
+		return LevelPlayer
+	case command.Name == "tournament" && len(command.Options) > 0 && playerTournamentActions[command.Options[0].StringValue()]:
+		return LevelPlayer
+	}
+	return LevelOrganizer
+}
+
+// Returns the level of the member behind an interaction. Members with the
+// Administrator permission are admins. Without configured roles, members who
+// can manage the server are admins and organizers.
+func memberLevel(db *Database, i *discordgo.InteractionCreate) PermissionLevel {
+	if i.Member == nil {
+		return LevelPlayer
+	}
+	if i.Member.Permissions&discordgo.PermissionAdministrator != 0 {
+		return LevelAdmin
+	}
+
+	roles := db.Settings.Roles
+	if roles.OrganizerRole == "" {
+		if i.Member.Permissions&discordgo.PermissionManageServer != 0 {
+			return LevelAdmin
+		}
+		return LevelPlayer
+	}
+
+	level := LevelPlayer
+	for _, role := range i.Member.Roles {
+		if roles.AdminRole != "" && role == roles.AdminRole {
+			return LevelAdmin
+		}
+		if role == roles.OrganizerRole {
+			level = LevelOrganizer
+		}
+	}
+	return level
+}
+
+// Reports whether the member behind an interaction can run a subcommand, denied attempts are logged
+func checkPermission(db *Database, i *discordgo.InteractionCreate, command *discordgo.ApplicationCommandInteractionDataOption) bool {
+	if memberLevel(db, i) >= commandLevel(command) {
+		return true
+	}
+	user := interactionUser(i)
+	log.Printf("Permission denied: %s (%s) tried to run %s in guild %s", user.Username, user.ID, command.Name, i.GuildID)
+	return false
+}
+
+// Sets the organizer and admin roles of a server
+func setGuildRoles(db *Database, organizerRole string, adminRole string) error {
+	db.Settings.Roles = GuildRoles{OrganizerRole: organizerRole, AdminRole: adminRole}
+	log.Print("Roles updated successfully")
+	return saveSettings(db)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// Builds the phases of a tournament from the start options
+func buildPhases(options TournamentOptions, numPlayers int) ([]Phase, error) {
+	format := options.Format
+	if format == "" {
+		format = FormatDoubleElimination
+	}
+	if options.Pools < 1 {
+		options.Pools = 1
+	}
+	if format == FormatRoundRobin && numPlayers < 2*options.Pools {
+		return nil, fmt.Errorf("not enough players for %d pools. Minimum 2 players per pool required", options.Pools)
+	}
+
+	first := Phase{Name: phaseName(format), Format: format, Status: TournamentStatusPending}
+	if format == FormatSwiss {
+		options.Pools = 1
+		first.SwissRounds = options.SwissRounds
+		if first.SwissRounds < 1 {
+			first.SwissRounds = defaultSwissRounds(numPlayers)
+		}
+		if first.SwissRounds > maxSwissRounds(numPlayers) {
+			return nil, fmt.Errorf("too many Swiss rounds, %d players can play at most %d rounds without rematches", numPlayers, maxSwissRounds(numPlayers))
+		}
+	}
+	if options.Advance == 0 {
+		return []Phase{first}, nil
+	}
+
+	if !hasStandings(format) {
+		return nil, fmt.Errorf("only pools or Swiss rounds can send players to a bracket")
+	}
+	if options.Advance > numPlayers/options.Pools {
+		return nil, fmt.Errorf("cannot advance %d players per pool, the smallest pool has %d players", options.Advance, numPlayers/options.Pools)
+	}
+	if options.Advance*options.Pools < 2 {
+		return nil, fmt.Errorf("at least 2 players must advance to the bracket")
+	}
+
+	bracketFormat := options.BracketFormat
+	if bracketFormat == "" {
+		bracketFormat = FormatDoubleElimination
+	}
+	if bracketFormat != FormatDoubleElimination && bracketFormat != FormatSingleElimination {
+		return nil, fmt.Errorf("the phase after pools must be an elimination bracket")
+	}
+
+	first.Advance = options.Advance
+	second := Phase{Name: phaseName(bracketFormat), Format: bracketFormat, Status: TournamentStatusPending}
+	return []Phase{first, second}, nil
+}
+
+// Returns the display name of a phase played with a format
+func phaseName(format TournamentFormat) string {
+	switch format {
+	case FormatRoundRobin:
+		return "Pools"
+	case FormatSwiss:
+		return "Swiss"
+	}
+	return "Bracket"
+}
+
+// Reports whether a format ranks players with standings rather than a bracket
+func hasStandings(format TournamentFormat) bool {
+	return format == FormatRoundRobin || format == FormatSwiss
+}
+
+// Returns the standings of a pool of a phase
+func phaseStandings(tournament *Tournament, phase int, pool int) []Standing {
+	if tournament.Phases[phase].Format == FormatSwiss {
+		return computeSwissStandings(tournament, phase)
+	}
+	return computeStandings(tournament, phase, pool)
+}
+
+// Returns the phase being played. A tournament without phases, which can only
+// come from a file that was not migrated, gets an empty one.
+func currentPhase(tournament *Tournament) *Phase {
+	if tournament.CurrentPhase < 0 || tournament.CurrentPhase >= len(tournament.Phases) {
+		return &Phase{}
+	}
+	return &tournament.Phases[tournament.CurrentPhase]
+}
+
+// Adds the rounds of the current phase to the tournament and starts it
+func startPhase(tournament *Tournament, rounds []Round) {
+	for r := range rounds {
+		rounds[r].Phase = tournament.CurrentPhase
+	}
+	tournament.Rounds = append(tournament.Rounds, rounds...)
+	currentPhase(tournament).Status = TournamentStatusOngoing
+	updateTournamentProgress(tournament)
+}
+
+// Seeds the top players of each pool of the finished phase into the bracket of the next phase
+func startNextPhase(tournament *Tournament) error {
+	previous := tournament.CurrentPhase
+	if previous+1 >= len(tournament.Phases) {
+		return fmt.Errorf("there is no phase left to play")
+	}
+
+	advance := tournament.Phases[previous].Advance
+	qualifiers := make([][]string, len(tournament.Phases[previous].Pools))
+	for p := range qualifiers {
+		for _, standing := range phaseStandings(tournament, previous, p+1)[:advance] {
+			qualifiers[p] = append(qualifiers[p], standing.Player)
+		}
+	}
+
+	tournament.CurrentPhase++
+	phase := currentPhase(tournament)
+	startPhase(tournament, buildEliminationBracket(poolQualifierSlots(qualifiers), phase.Format == FormatDoubleElimination))
+	log.Printf("Phase %s started", phase.Name)
+	return nil
+}
+
+// Seeds pool qualifiers into the first round slots of a bracket. Pool winners
+// get the top seeds, then runners-up and so on. Within each rank, players take
+// the free seed that keeps them apart from their pool mates for the longest.
+func poolQualifierSlots(qualifiers [][]string) []string {
+	count, maxRank := 0, 0
+	for _, pool := range qualifiers {
+		count += len(pool)
+		if len(pool) > maxRank {
+			maxRank = len(pool)
+		}
+	}
+
+	size := LargestPowerOfTwo(count)
+	if size < 2 {
+		size = 2
+	}
+	order := seedOrder(size)
+	slotOfSeed := make([]int, size+1)
+	for slot, seed := range order {
+		slotOfSeed[seed] = slot
+	}
+
+	slots := make([]string, size)
+	taken := make([][]int, len(qualifiers))
+	nextSeed := 1
+	for rank := 0; rank < maxRank; rank++ {
+		var tier []int
+		for p := range qualifiers {
+			if rank < len(qualifiers[p]) {
+				tier = append(tier, p)
+			}
+		}
+		// Snake the pool order so the same pool does not always get the best seed of a rank
+		if rank%2 == 1 {
+			for a, b := 0, len(tier)-1; a < b; a, b = a+1, b-1 {
+				tier[a], tier[b] = tier[b], tier[a]
+			}
+		}
+
+		free := make([]int, len(tier))
+		for k := range free {
+			free[k] = nextSeed + k
+		}
+		nextSeed += len(tier)
+
+		for _, p := range tier {
+			best, bestRound := 0, -1
+			for k, seed := range free {
+				meeting := size
+				for _, slot := range taken[p] {
+					if r := meetingRound(slotOfSeed[seed], slot); r < meeting {
+						meeting = r
+					}
+				}
+				if meeting > bestRound {
+					best, bestRound = k, meeting
+				}
+			}
+			slot := slotOfSeed[free[best]]
+			slots[slot] = qualifiers[p][rank]
+			taken[p] = append(taken[p], slot)
+			free = append(free[:best], free[best+1:]...)
+		}
+	}
+	return slots
+}
@@ -1,19 +1,57 @@
 // Importation des hooks depuis React
 const { useState, useEffect } = React;
 
+// Personnages joués par un joueur pendant le set, dans l'ordre
+const playerCharacters = (match, player) => {
+    const characters = [];
+    (match.games || []).forEach(game => {
+        const character = game.winner === player ? game.winner_character : game.loser_character;
+        if (character && !characters.includes(character)) {
+            characters.push(character);
+        }
+    });
+    return characters;
+};
+
 const Match = ({ match, round, isCurrentRound }) => {
     if (!match) return null;
 
     const bgColor = isCurrentRound && !match.winner ? 'bg-blue-900' : 'bg-gray-700';
+    const hasScore = match.player1_score > 0 || match.player2_score > 0;
+    const score = (player) => {
+        if (!hasScore || match.winner !== player) return null;
+        const [won, lost] = player === match.player1
+            ? [match.player1_score, match.player2_score]
+            : [match.player2_score, match.player1_score];
+        return <span className="ml-2 text-gray-300">{won}-{lost}</span>;
+    };
+    const characters = (player) => {
+        const played = playerCharacters(match, player);
+        if (!player || played.length === 0) return null;
+        return (
+            <div className="text-xs text-gray-400">{played.join(', ')}</div>
+        );
+    };
 
     return (
         <div className={`relative ${bgColor} p-3 rounded-lg w-48 transition-colors duration-300`}>
             <div className={`${match.winner === match.player1 ? 'text-green-400' : match.winner === match.player2 ? 'text-red-400' : 'text-gray-200'} font-medium`}>
-                {match.player1 || 'TBD'}
-            </div>
-            <div className={`${match.winner === match.player2 ? 'text-green-400' : match.winner === match.player1 ? 'text-red-400' : 'text-gray-200'} font-medium mt-1`}>
-                {match.player2 || 'TBD'}
+                {match.player1 || 'TBD'}{score(match.player1)}
+                {characters(match.player1)}
             </div>
+            {match.bye ? (
+                <div className="text-gray-500 font-medium mt-1">Bye</div>
+            ) : (
+                <div className={`${match.winner === match.player2 ? 'text-green-400' : match.winner === match.player1 ? 'text-red-400' : 'text-gray-200'} font-medium mt-1`}>
+                    {match.player2 || 'TBD'}{score(match.player2)}
+                    {characters(match.player2)}
+                </div>
+            )}
+            {match.best_of > 0 && !match.bye && (
+                <div className="text-xs text-gray-400 mt-1">
+                    Bo{match.best_of}
+                </div>
+            )}
             {match.table_id && (
                 <div className="text-xs text-gray-400 mt-1">
                     Table {match.table_id}
@@ -30,7 +68,8 @@ const TournamentBracket = () => {
     useEffect(() => {
         console.log("Fetching tournament data...");
 
-        fetch('/api/tournament')
+        // Le serveur Discord est passé dans l'URL de la page, ex. /?guild=123
+        fetch('/api/tournament' + window.location.search)
             .then(response => {
                 console.log("Response received:", response);
                 if (!response.ok) {
@@ -74,11 +113,19 @@ const TournamentBracket = () => {
 
     // Fonction pour vérifier si un joueur a perdu
     const hasPlayerLost = (playerName) => {
-        return tournament.rounds.some(round =>
-            round.matches.some(match =>
-                match.winner && match.winner !== playerName && (match.player1 === playerName || match.player2 === playerName)
-            )
-        );
+        const bracketPhases = tournament.phases
+            .map((phase, index) => ({ phase, index }))
+            .filter(({ phase }) => phase.format !== 'round_robin' && phase.format !== 'swiss');
+        if (bracketPhases.length === 0) return false;
+
+        const { phase, index } = bracketPhases[bracketPhases.length - 1];
+        const losses = tournament.rounds
+            .filter(round => round.phase === index)
+            .reduce((count, round) =>
+                count + round.matches.filter(match =>
+                    match.winner && match.winner !== playerName && (match.player1 === playerName || match.player2 === playerName)
+                ).length, 0);
+        return losses >= (phase.format === 'single_elimination' ? 1 : 2);
     };
 
     // Fonction pour vérifier si un joueur est toujours en jeu
@@ -89,6 +136,16 @@ const TournamentBracket = () => {
         );
     };
 
+    const currentRound = tournament.rounds[tournament.current_round];
+
+    const brackets = [
+        { side: 'pools', label: 'Pools' },
+        { side: 'swiss', label: 'Swiss' },
+        { side: 'winners', label: 'Winners Bracket' },
+        { side: 'losers', label: 'Losers Bracket' },
+        { side: 'grand_finals', label: 'Grand Finals' },
+    ];
+
     return (
         <div className="min-h-screen bg-gray-900 text-gray-200 p-8">
             <div className="flex gap-8">
@@ -131,31 +188,46 @@ const TournamentBracket = () => {
                                     tournament.status === 'complete' ? 'text-green-400' :
                                         'text-gray-400'
                             }`}>{tournament.status.toUpperCase()}</span></div>
-                            <div>Round: <span className="font-semibold text-blue-400">{tournament.current_round + 1}</span></div>
+                            {tournament.phases.length > 1 && (
+                                <div>Phase: <span className="font-semibold text-blue-400">{tournament.phases[tournament.current_phase].name}</span></div>
+                            )}
+                            <div>Round: <span className="font-semibold text-blue-400">{currentRound.id}</span></div>
                         </div>
                     </div>
 
-                    <div className="flex gap-24 items-center">
-                        {tournament.rounds.map((round, roundIndex) => (
-                            <div
-                                key={roundIndex}
-                                className={`flex flex-col gap-16 ${roundIndex === 0 ? 'mt-0' : 'mt-8'}`}
-                            >
-                                {round.matches.map((match, matchIndex) => (
-                                    <div
-                                        key={`${roundIndex}-${matchIndex}`}
-                                        className="relative"
-                                    >
-                                        <Match
-                                            match={match}
-                                            round={roundIndex}
-                                            isCurrentRound={roundIndex === tournament.current_round}
-                                        />
-                                    </div>
-                                ))}
+                    {brackets.map(bracket => {
+                        const rounds = tournament.rounds
+                            .map((round, roundIndex) => ({ round, roundIndex }))
+                            .filter(({ round }) => round.bracket === bracket.side);
+                        if (rounds.length === 0) return null;
+
+                        return (
+                            <div key={bracket.side} className="mb-12">
+                                <h2 className="text-lg font-semibold mb-4 text-gray-400">{bracket.label}</h2>
+                                <div className="flex gap-24 items-center">
+                                    {rounds.map(({ round, roundIndex }) => (
+                                        <div
+                                            key={roundIndex}
+                                            className={`flex flex-col gap-16 ${round.number === 1 ? 'mt-0' : 'mt-8'}`}
+                                        >
+                                            {round.matches.map((match, matchIndex) => (
+                                                <div
+                                                    key={`${roundIndex}-${matchIndex}`}
+                                                    className="relative"
+                                                >
+                                                    <Match
+                                                        match={match}
+                                                        round={roundIndex}
+                                                        isCurrentRound={roundIndex === tournament.current_round}
+                                                    />
+                                                </div>
+                                            ))}
+                                        </div>
+                                    ))}
+                                </div>
                             </div>
-                        ))}
-                    </div>
+                        );
+                    })}
                 </div>
             </div>
         </div>
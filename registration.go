@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Prefix of the custom ID of sign-up buttons, followed by the action and the tournament ID
+const signupButtonPrefix = "signup"
+
+// Sign-ups of a tournament that hasn't started yet. Players past the cap wait
+// on the waitlist and move up when an entrant leaves.
+type Registration struct {
+	Open      bool      `json:"open"`
+	Cap       int       `json:"cap,omitempty"`
+	ClosesAt  time.Time `json:"closes_at"`
+	Entrants  []string  `json:"entrants"`
+	Waitlist  []string  `json:"waitlist,omitempty"`
+	ChannelID string    `json:"channel_id"`
+	MessageID string    `json:"message_id"`
+}
+
+// Returns the current tournament when it is still taking sign-ups or waiting to start
+func pendingTournament(db *Database) *Tournament {
+	tournament := getCurrentTournament(db)
+	if tournament == nil || tournament.Status != TournamentStatusPending || tournament.Registration == nil {
+		return nil
+	}
+	return tournament
+}
+
+// Returns a new tournament taking sign-ups, not saved until its message is
+// posted. A cap of 0 takes every player, and a zero closing time keeps sign-ups
+// open until they are closed or the tournament starts. Sign-ups can't open while
+// a tournament is being played, it would stop being the current one.
+func newRegistration(db *Database, limit int, closesAt time.Time) (*Tournament, error) {
+	if pending := pendingTournament(db); pending != nil {
+		return nil, fmt.Errorf("sign-ups are already open for tournament %s", pending.ID)
+	}
+	if current := getCurrentTournament(db); current != nil && current.Status == TournamentStatusOngoing {
+		return nil, fmt.Errorf("tournament %s is still being played", current.ID)
+	}
+	if limit == 1 || limit < 0 {
+		return nil, fmt.Errorf("the cap must be at least 2 players")
+	}
+	return &Tournament{
+		ID:           strconv.Itoa(len(db.Tournaments) + 1),
+		Status:       TournamentStatusPending,
+		Players:      make([]string, 0),
+		IsFirstRound: true,
+		Registration: &Registration{Open: true, Cap: limit, ClosesAt: closesAt, Entrants: []string{}},
+	}, nil
+}
+
+// Saves a tournament taking sign-ups as the current tournament
+func openRegistration(db *Database, tournament *Tournament) error {
+	if pending := pendingTournament(db); pending != nil {
+		return fmt.Errorf("sign-ups are already open for tournament %s", pending.ID)
+	}
+	recordEvent(db, EventRegistrationOpened, fmt.Sprintf("Sign-ups opened for tournament %s", tournament.ID))
+	db.Tournaments = append(db.Tournaments, *tournament)
+	log.Print("Sign-ups opened successfully")
+	return saveTournament(db, getCurrentTournament(db))
+}
+
+// Closes the sign-ups of the pending tournament, entrants stay until it starts
+func closeRegistration(db *Database) error {
+	tournament := pendingTournament(db)
+	if tournament == nil || !tournament.Registration.Open {
+		return fmt.Errorf("no sign-ups are open")
+	}
+	recordEvent(db, EventRegistrationClosed, fmt.Sprintf("Sign-ups closed for tournament %s with %d entrants", tournament.ID, len(tournament.Registration.Entrants)))
+	tournament.Registration.Open = false
+	log.Print("Sign-ups closed successfully")
+	return saveTournament(db, tournament)
+}
+
+// Reports whether a name is in a list of players
+func containsPlayer(players []string, name string) bool {
+	for _, player := range players {
+		if player == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a list of players without a name
+func withoutPlayer(players []string, name string) []string {
+	var kept []string
+	for _, player := range players {
+		if player != name {
+			kept = append(kept, player)
+		}
+	}
+	return kept
+}
+
+// Signs a player up for the pending tournament, on the waitlist once the cap is
+// reached. Reports whether the player was waitlisted.
+func joinRegistration(db *Database, player string) (bool, error) {
+	tournament := pendingTournament(db)
+	if tournament == nil || !tournament.Registration.Open {
+		return false, fmt.Errorf("no sign-ups are open")
+	}
+	registration := tournament.Registration
+	if containsPlayer(registration.Entrants, player) {
+		return false, fmt.Errorf("%s is already signed up", player)
+	}
+	if containsPlayer(registration.Waitlist, player) {
+		return false, fmt.Errorf("%s is already on the waitlist", player)
+	}
+
+	waitlisted := registration.Cap > 0 && len(registration.Entrants) >= registration.Cap
+	if waitlisted {
+		recordEvent(db, EventEntrantJoined, fmt.Sprintf("%s joined the waitlist of tournament %s", player, tournament.ID))
+		registration.Waitlist = append(registration.Waitlist, player)
+	} else {
+		recordEvent(db, EventEntrantJoined, fmt.Sprintf("%s signed up for tournament %s", player, tournament.ID))
+		registration.Entrants = append(registration.Entrants, player)
+	}
+	log.Print("Player signed up successfully")
+	return waitlisted, saveTournament(db, tournament)
+}
+
+// Takes a player off the pending tournament. When an entrant leaves, the first
+// player of the waitlist takes their spot and is returned.
+func leaveRegistration(db *Database, player string) (string, error) {
+	tournament := pendingTournament(db)
+	if tournament == nil || !tournament.Registration.Open {
+		return "", fmt.Errorf("no sign-ups are open")
+	}
+	registration := tournament.Registration
+	if !containsPlayer(registration.Entrants, player) && !containsPlayer(registration.Waitlist, player) {
+		return "", fmt.Errorf("%s is not signed up", player)
+	}
+
+	recordEvent(db, EventEntrantLeft, fmt.Sprintf("%s left tournament %s", player, tournament.ID))
+	var promoted string
+	if containsPlayer(registration.Entrants, player) {
+		registration.Entrants = withoutPlayer(registration.Entrants, player)
+		if len(registration.Waitlist) > 0 {
+			promoted = registration.Waitlist[0]
+			registration.Waitlist = registration.Waitlist[1:]
+			registration.Entrants = append(registration.Entrants, promoted)
+		}
+	} else {
+		registration.Waitlist = withoutPlayer(registration.Waitlist, player)
+	}
+	log.Print("Player left sign-ups successfully")
+	return promoted, saveTournament(db, tournament)
+}
+
+// Returns the players signed up for a tournament, in the order they joined
+func registrationPlayers(db *Database, registration *Registration) []Player {
+	var players []Player
+	for _, name := range registration.Entrants {
+		for _, p := range db.Players {
+			if p.Username == name {
+				players = append(players, p)
+			}
+		}
+	}
+	return players
+}
+
+// Returns the description and buttons of the sign-up message of a tournament
+func registrationMessage(tournament *Tournament) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	registration := tournament.Registration
+	var description strings.Builder
+	if registration.Cap > 0 {
+		description.WriteString(fmt.Sprintf("Entrants: %d/%d\n", len(registration.Entrants), registration.Cap))
+	} else {
+		description.WriteString(fmt.Sprintf("Entrants: %d\n", len(registration.Entrants)))
+	}
+	for n, player := range registration.Entrants {
+		description.WriteString(fmt.Sprintf("%d. %s\n", n+1, player))
+	}
+	if len(registration.Waitlist) > 0 {
+		description.WriteString(fmt.Sprintf("\nWaitlist: %s\n", strings.Join(registration.Waitlist, ", ")))
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Sign-ups - Tournament %s", tournament.ID),
+		Color: 0x00FF00,
+	}
+	switch {
+	case tournament.Status != TournamentStatusPending:
+		description.WriteString("\nThe tournament has started.")
+		embed.Color = 0xFFFF00
+	case !registration.Open:
+		description.WriteString("\nSign-ups are closed.")
+		embed.Color = 0xFFFF00
+	case !registration.ClosesAt.IsZero():
+		description.WriteString(fmt.Sprintf("\nSign-ups close <t:%d:R>.", registration.ClosesAt.Unix()))
+	}
+	embed.Description = description.String()
+
+	if tournament.Status != TournamentStatusPending || !registration.Open {
+		return embed, []discordgo.MessageComponent{}
+	}
+	return embed, []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Join",
+					Style:    discordgo.SuccessButton,
+					CustomID: fmt.Sprintf("%s:join:%s", signupButtonPrefix, tournament.ID),
+				},
+				discordgo.Button{
+					Label:    "Leave",
+					Style:    discordgo.DangerButton,
+					CustomID: fmt.Sprintf("%s:leave:%s", signupButtonPrefix, tournament.ID),
+				},
+			},
+		},
+	}
+}
+
+// Posts the sign-up message of a new tournament in a channel and keeps track of
+// it to update the entrant count
+func postRegistration(s *discordgo.Session, tournament *Tournament, channelID string) error {
+	embed, components := registrationMessage(tournament)
+	message, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil {
+		return fmt.Errorf("error sending sign-ups: %w", err)
+	}
+	tournament.Registration.ChannelID = channelID
+	tournament.Registration.MessageID = message.ID
+	return nil
+}
+
+// Updates the sign-up message of a tournament after a change made elsewhere
+func refreshRegistration(s *discordgo.Session, tournament *Tournament) {
+	if tournament == nil || tournament.Registration == nil || tournament.Registration.MessageID == "" {
+		return
+	}
+	embed, components := registrationMessage(tournament)
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         tournament.Registration.MessageID,
+		Channel:    tournament.Registration.ChannelID,
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+	})
+	if err != nil {
+		log.Printf("Error updating sign-ups: %v", err)
+	}
+}
+
+// Handles a click on the join or leave button of a sign-up message. Members who
+// are not players yet are registered with their Discord username.
+func handleSignupButton(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, action string, tournamentID string) {
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+	tournament := pendingTournament(db)
+	if tournament == nil || tournament.ID != tournamentID {
+		sendEphemeralResponse(s, i, "Erreur", "Sign-ups for this tournament are over", 0xFF0000)
+		return
+	}
+
+	player := playerNameForUser(db, user)
+	var notice string
+	switch action {
+	case "join":
+		if playerDiscordID(db, player) != user.ID {
+			registered, err := registerPlayer(db, user.ID, user.Username)
+			if err != nil {
+				sendEphemeralResponse(s, i, "Erreur", "Error registering: "+err.Error(), 0xFF0000)
+				return
+			}
+			player = registered.Username
+		}
+		waitlisted, err := joinRegistration(db, player)
+		if err != nil {
+			sendEphemeralResponse(s, i, "Erreur", "Error signing up: "+err.Error(), 0xFF0000)
+			return
+		}
+		if waitlisted {
+			notice = fmt.Sprintf("<@%s> the tournament is full, you are on the waitlist.", user.ID)
+		}
+	case "leave":
+		if player == "" {
+			sendEphemeralResponse(s, i, "Erreur", "You are not signed up", 0xFF0000)
+			return
+		}
+		promoted, err := leaveRegistration(db, player)
+		if err != nil {
+			sendEphemeralResponse(s, i, "Erreur", "Error leaving: "+err.Error(), 0xFF0000)
+			return
+		}
+		if promoted != "" {
+			notice = playerMentions(db, []string{promoted}) + " a spot opened up, you are in!"
+		}
+	default:
+		return
+	}
+
+	embed, components := registrationMessage(getCurrentTournament(db))
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error updating sign-ups: %v", err)
+	}
+	if notice != "" {
+		if _, err := s.ChannelMessageSend(i.ChannelID, notice); err != nil {
+			log.Printf("Error sending sign-up notice: %v", err)
+		}
+	}
+}
+
+// Closes the sign-ups of a server once their closing time has passed
+func closeExpiredRegistration(s *discordgo.Session, guildID string, now time.Time) {
+	expired := func(db *Database) bool {
+		tournament := pendingTournament(db)
+		return tournament != nil && tournament.Registration.Open &&
+			!tournament.Registration.ClosesAt.IsZero() && !now.Before(tournament.Registration.ClosesAt)
+	}
+	if saved, err := state.snapshot(guildID); err != nil || !expired(saved) {
+		return
+	}
+	db, unlock, err := state.acquire(guildID)
+	if err != nil {
+		log.Printf("Error loading database: %v", err)
+		return
+	}
+	defer unlock()
+	if !expired(db) {
+		return
+	}
+	if err := closeRegistration(db); err != nil {
+		log.Printf("Error closing sign-ups: %v", err)
+		return
+	}
+	refreshRegistration(s, getCurrentTournament(db))
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Prefix of the custom ID of report buttons, followed by the action and the match ID
+const reportButtonPrefix = "report"
+
+// Minutes after which a report nobody answered is confirmed, when not configured
+const defaultReportTimeout = 10
+
+type ReportStatus string
+
+const (
+	ReportStatusPending  ReportStatus = "pending"
+	ReportStatusDisputed ReportStatus = "disputed"
+)
+
+// Result submitted by a player, waiting for their opponent to confirm it
+type Report struct {
+	Reporter   string       `json:"reporter"`
+	Winner     string       `json:"winner"`
+	Score      string       `json:"score"`
+	Status     ReportStatus `json:"status"`
+	ChannelID  string       `json:"channel_id"`
+	ReportedAt time.Time    `json:"reported_at"`
+}
+
+// Bot settings of a server, shared by every tournament
+type Settings struct {
+	ReportTimeout  int        `json:"report_timeout"`
+	Roles          GuildRoles `json:"roles"`
+	CalloutChannel string     `json:"callout_channel,omitempty"`
+	CheckInTimeout int        `json:"checkin_timeout,omitempty"`
+	ThreadChannel  string     `json:"thread_channel,omitempty"`
+	PrivateThreads bool       `json:"private_threads,omitempty"`
+	// Shows the bracket of the server on the web server
+	WebBracketServed bool `json:"web_bracket_served,omitempty"`
+}
+
+// Returns the number of minutes before a report is confirmed on its own
+func reportTimeout(db *Database) time.Duration {
+	minutes := db.Settings.ReportTimeout
+	if minutes <= 0 {
+		minutes = defaultReportTimeout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Changes the number of minutes before a report is confirmed on its own
+func setReportTimeout(db *Database, minutes int) error {
+	if minutes < 1 {
+		return fmt.Errorf("the timeout must be at least 1 minute")
+	}
+	db.Settings.ReportTimeout = minutes
+	log.Print("Report timeout updated successfully")
+	return saveSettings(db)
+}
+
+// Returns the name of the player of a match a Discord user plays as
+func matchPlayerName(match Match, username string) (string, bool) {
+	for _, player := range []string{match.Player1, match.Player2} {
+		if player != "" && strings.EqualFold(player, username) {
+			return player, true
+		}
+	}
+	return "", false
+}
+
+// Records a result submitted by one of the players of a match. The result is
+// checked right away but only recorded once the opponent confirms it.
+func submitReport(db *Database, matchID string, reporter string, winnerName string, score string, channelID string) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return fmt.Errorf("match not found")
+	}
+	if !isMatchReady(*match) {
+		return fmt.Errorf("this match is not being played")
+	}
+	player, ok := matchPlayerName(*match, reporter)
+	if !ok {
+		return fmt.Errorf("only %s and %s can report this match", match.Player1, match.Player2)
+	}
+	winner, ok := matchPlayerName(*match, winnerName)
+	if !ok {
+		return fmt.Errorf("the winner must be one of the players in the match: %s ou %s", match.Player1, match.Player2)
+	}
+	winnerGames, loserGames, err := parseScore(score)
+	if err != nil {
+		return err
+	}
+	if err := checkScore(*match, winner, winnerGames, loserGames); err != nil {
+		return err
+	}
+	if match.Report != nil && match.Report.Status == ReportStatusDisputed {
+		return fmt.Errorf("this match is disputed, an organizer will record the result")
+	}
+
+	recordEvent(db, EventReportSubmitted, fmt.Sprintf("Match %s: %s reported %s winning %s", match.ID, player, winner, score))
+	match.Report = &Report{
+		Reporter:   player,
+		Winner:     winner,
+		Score:      score,
+		Status:     ReportStatusPending,
+		ChannelID:  channelID,
+		ReportedAt: time.Now(),
+	}
+	log.Print("Match reported successfully")
+	return saveTournament(db, tournament)
+}
+
+// Confirms the pending report of a match on behalf of the opponent of the reporter
+func confirmReport(db *Database, matchID string, username string) error {
+	match, err := pendingReportMatch(db, matchID, username)
+	if err != nil {
+		return err
+	}
+	return updateMatchResult(db, matchID, match.Report.Winner, match.Report.Score)
+}
+
+// Disputes the pending report of a match, it waits for an organizer from then on
+func disputeReport(db *Database, matchID string, username string) error {
+	match, err := pendingReportMatch(db, matchID, username)
+	if err != nil {
+		return err
+	}
+	recordEvent(db, EventReportDisputed, fmt.Sprintf("Match %s: report disputed by %s", matchID, username))
+	match.Report.Status = ReportStatusDisputed
+	log.Print("Match report disputed")
+	return saveTournament(db, getCurrentTournament(db))
+}
+
+// Returns a match with a pending report that a user can answer as the opponent of the reporter
+func pendingReportMatch(db *Database, matchID string, username string) (*Match, error) {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil, fmt.Errorf("no active tournament")
+	}
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return nil, fmt.Errorf("match not found")
+	}
+	if match.Report == nil || match.Report.Status != ReportStatusPending || match.Winner != "" {
+		return nil, fmt.Errorf("no pending report for this match")
+	}
+	player, ok := matchPlayerName(*match, username)
+	if !ok || player == match.Report.Reporter {
+		return nil, fmt.Errorf("only %s can answer this report", opponent(*match, match.Report.Reporter))
+	}
+	return match, nil
+}
+
+// Confirms every pending report older than the timeout and returns the confirmed matches
+func autoConfirmReports(db *Database, now time.Time) []Match {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil
+	}
+
+	var expired []Match
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			report := match.Report
+			if report != nil && report.Status == ReportStatusPending && match.Winner == "" && now.Sub(report.ReportedAt) >= reportTimeout(db) {
+				expired = append(expired, match)
+			}
+		}
+	}
+
+	var confirmed []Match
+	for _, match := range expired {
+		if err := updateMatchResult(db, match.ID, match.Report.Winner, match.Report.Score); err != nil {
+			log.Printf("Error auto-confirming match %s: %v", match.ID, err)
+			continue
+		}
+		confirmed = append(confirmed, match)
+	}
+	return confirmed
+}
+
+// Returns the matches whose report was disputed, waiting for an organizer
+func disputedMatches(db *Database) []Match {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil
+	}
+	var disputed []Match
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			if match.Report != nil && match.Report.Status == ReportStatusDisputed && match.Winner == "" {
+				disputed = append(disputed, match)
+			}
+		}
+	}
+	return disputed
+}
+
+// Formats the organizer queue of disputed reports
+func formatDisputes(db *Database) string {
+	disputed := disputedMatches(db)
+	if len(disputed) == 0 {
+		return "No disputed match."
+	}
+	var result string
+	for _, match := range disputed {
+		result += fmt.Sprintf("Match %s: %s vs %s - %s reported %s winning %s (%s ago)\n",
+			match.ID, match.Player1, match.Player2, match.Report.Reporter, match.Report.Winner,
+			match.Report.Score, time.Since(match.Report.ReportedAt).Round(time.Minute))
+	}
+	result += fmt.Sprintf("\nUse /%s match to record the right result.", BOT_COMMAND_PREFIX)
+	return result
+}
+
+// Returns the confirm and dispute buttons of a report
+func reportButtons(matchID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Confirm",
+					Style:    discordgo.SuccessButton,
+					CustomID: fmt.Sprintf("%s:confirm:%s", reportButtonPrefix, matchID),
+				},
+				discordgo.Button{
+					Label:    "Dispute",
+					Style:    discordgo.DangerButton,
+					CustomID: fmt.Sprintf("%s:dispute:%s", reportButtonPrefix, matchID),
+				},
+			},
+		},
+	}
+}
+
+// Sends a report with the buttons its opponent answers with
+func sendReportMessage(s *discordgo.Session, i *discordgo.InteractionCreate, match Match) {
+	report := match.Report
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title: "Result reported",
+					Description: fmt.Sprintf("Match %s: %s vs %s\n%s reported **%s** winning **%s**.\n\n%s, please confirm or dispute this result.",
+						match.ID, match.Player1, match.Player2, report.Reporter, report.Winner, report.Score, opponent(match, report.Reporter)),
+					Color: 0xFFFF00,
+				},
+			},
+			Components: reportButtons(match.ID),
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending report: %v", err)
+	}
+}
+
+// Handles a click on the confirm or dispute button of a report
+func handleReportButton(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, action string, matchID string) {
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+
+	var err error
+	var title, description string
+	color := 0x00FF00
+	switch action {
+	case "confirm":
+		err = confirmReport(db, matchID, playerNameForUser(db, user))
+		title, description = "Succès", fmt.Sprintf("Result of match %s confirmed by %s.", matchID, playerNameForUser(db, user))
+	case "dispute":
+		err = disputeReport(db, matchID, playerNameForUser(db, user))
+		title, description = "Disputed", fmt.Sprintf("%s disputed the result of match %s. An organizer will record the result.", playerNameForUser(db, user), matchID)
+		color = 0xFF0000
+	default:
+		return
+	}
+	if err != nil {
+		sendEphemeralResponse(s, i, "Erreur", err.Error(), 0xFF0000)
+		return
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       title,
+					Description: description,
+					Color:       color,
+				},
+			},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		log.Printf("Error updating report: %v", err)
+	}
+}
+
+// Confirms expired reports, follows up on the matches it changed, pings
+// players late to check in and closes sign-ups on time every minute until
+// stop is closed
+func runTimers(s *discordgo.Session, stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			guilds, err := dataStore.Guilds()
+			if err != nil {
+				log.Printf("Error loading database: %v", err)
+				continue
+			}
+			for _, guildID := range guilds {
+				if guildID != legacyGuildID {
+					confirmGuildReports(s, guildID, now)
+					followUpChanges(s, guildID)
+					pingLatePlayers(s, guildID, now)
+					closeExpiredRegistration(s, guildID, now)
+				}
+			}
+		}
+	}
+}
+
+// Confirms the expired reports of a server and announces them where they were reported
+func confirmGuildReports(s *discordgo.Session, guildID string, now time.Time) {
+	db, unlock, err := state.acquire(guildID)
+	if err != nil {
+		log.Printf("Error loading database: %v", err)
+		return
+	}
+	defer unlock()
+	for _, match := range autoConfirmReports(db, now) {
+		if match.Report.ChannelID == "" {
+			continue
+		}
+		_, err := s.ChannelMessageSendEmbed(match.Report.ChannelID, &discordgo.MessageEmbed{
+			Title: "Result confirmed",
+			Description: fmt.Sprintf("Nobody answered in time, %s winning %s is recorded for match %s.",
+				match.Report.Winner, match.Report.Score, match.ID),
+			Color: 0x00FF00,
+		})
+		if err != nil {
+			log.Printf("Error sending confirmation: %v", err)
+		}
+	}
+}
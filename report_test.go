@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestUnlinkedImpersonator(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	match := getCurrentTournament(db).Rounds[0].Matches[0]
+	score := fmt.Sprintf("%d-0", gamesToWin(match))
+	for p := range db.Players {
+		if db.Players[p].Username == match.Player1 {
+			db.Players[p].DiscordID = "100"
+		}
+	}
+
+	// An unlinked member named like the linked player, in another case
+	impersonator := &discordgo.User{ID: "999", Username: strings.ToUpper(match.Player1)}
+	if name := playerNameForUser(db, impersonator); name != "" {
+		t.Fatalf("impersonator plays as %q", name)
+	}
+	if err := submitReport(db, match.ID, playerNameForUser(db, impersonator), match.Player1, score, ""); err == nil {
+		t.Error("impersonator reported the match")
+	}
+
+	// The linked account and unlinked players still play as themselves
+	owner := &discordgo.User{ID: "100", Username: "someone"}
+	if name := playerNameForUser(db, owner); name != match.Player1 {
+		t.Errorf("linked account plays as %q", name)
+	}
+	opponent := &discordgo.User{ID: "200", Username: match.Player2}
+	if err := submitReport(db, match.ID, playerNameForUser(db, opponent), match.Player2, score, ""); err != nil {
+		t.Errorf("unlinked player could not report: %v", err)
+	}
+	if err := confirmReport(db, match.ID, playerNameForUser(db, impersonator)); err == nil {
+		t.Error("impersonator confirmed the report")
+	}
+	if err := confirmReport(db, match.ID, playerNameForUser(db, owner)); err != nil {
+		t.Errorf("linked account could not confirm: %v", err)
+	}
+}
+
+func TestResultAgainstRecordedGames(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	match := getCurrentTournament(db).Rounds[0].Matches[0]
+	if err := recordGame(db, match.ID, Game{Winner: match.Player1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Player 1 leads the set, player 2 can't be reported as the winner without a score
+	if err := updateMatchResult(db, match.ID, match.Player2, ""); err == nil {
+		t.Error("the loser of the recorded games was reported as the winner")
+	}
+	if err := updateMatchResult(db, match.ID, match.Player1, ""); err != nil {
+		t.Fatalf("the leader of the recorded games could not be reported: %v", err)
+	}
+	played := *findMatch(getCurrentTournament(db), match.ID)
+	if played.Winner != match.Player1 || played.Player1Score != 1 || played.Player2Score != 0 {
+		t.Errorf("got winner %s and score %d-%d", played.Winner, played.Player1Score, played.Player2Score)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Smash game a tournament is played on
+type GameTitle string
+
+const (
+	GameUltimate GameTitle = "ultimate"
+	GameMelee    GameTitle = "melee"
+)
+
+// Characters playable in each game
+var rosters = map[GameTitle][]string{
+	GameUltimate: {
+		"Mario", "Donkey Kong", "Link", "Samus", "Dark Samus", "Yoshi", "Kirby", "Fox",
+		"Pikachu", "Luigi", "Ness", "Captain Falcon", "Jigglypuff", "Peach", "Daisy", "Bowser",
+		"Ice Climbers", "Sheik", "Zelda", "Dr. Mario", "Pichu", "Falco", "Marth", "Lucina",
+		"Young Link", "Ganondorf", "Mewtwo", "Roy", "Chrom", "Mr. Game & Watch", "Meta Knight", "Pit",
+		"Dark Pit", "Zero Suit Samus", "Wario", "Snake", "Ike", "Pokémon Trainer", "Diddy Kong", "Lucas",
+		"Sonic", "King Dedede", "Olimar", "Lucario", "R.O.B.", "Toon Link", "Wolf", "Villager",
+		"Mega Man", "Wii Fit Trainer", "Rosalina & Luma", "Little Mac", "Greninja", "Mii Brawler", "Mii Swordfighter", "Mii Gunner",
+		"Palutena", "Pac-Man", "Robin", "Shulk", "Bowser Jr.", "Duck Hunt", "Ryu", "Ken",
+		"Cloud", "Corrin", "Bayonetta", "Inkling", "Ridley", "Simon", "Richter", "King K. Rool",
+		"Isabelle", "Incineroar", "Piranha Plant", "Joker", "Hero", "Banjo & Kazooie", "Terry", "Byleth",
+		"Min Min", "Steve", "Sephiroth", "Pyra/Mythra", "Kazuya", "Sora",
+	},
+	GameMelee: {
+		"Dr. Mario", "Mario", "Luigi", "Bowser", "Peach", "Yoshi", "Donkey Kong", "Captain Falcon",
+		"Ganondorf", "Falco", "Fox", "Ness", "Ice Climbers", "Kirby", "Samus", "Zelda",
+		"Sheik", "Link", "Young Link", "Pichu", "Pikachu", "Jigglypuff", "Mewtwo", "Mr. Game & Watch",
+		"Marth", "Roy",
+	},
+}
+
+// Tournament legal stages of each game
+var stageLists = map[GameTitle][]string{
+	GameUltimate: {
+		"Battlefield", "Small Battlefield", "Final Destination", "Pokémon Stadium 2", "Smashville",
+		"Town and City", "Kalos Pokémon League", "Lylat Cruise", "Yoshi's Story", "Hollow Bastion",
+		"Northern Cave",
+	},
+	GameMelee: {
+		"Battlefield", "Final Destination", "Dream Land N64", "Yoshi's Story", "Fountain of Dreams",
+		"Pokémon Stadium",
+	},
+}
+
+// Stocks each player starts a game with
+var stockCounts = map[GameTitle]int{
+	GameUltimate: 3,
+	GameMelee:    4,
+}
+
+// Returns the game a tournament is played on, Ultimate for tournaments created before it was recorded
+func tournamentGame(tournament *Tournament) GameTitle {
+	if tournament.Game == "" {
+		return GameUltimate
+	}
+	return tournament.Game
+}
+
+// Returns a lowercase name without accents, spaces or punctuation, used to
+// compare names typed by players and to name character icons
+func nameSlug(name string) string {
+	name = strings.NewReplacer("é", "e", "É", "e").Replace(strings.ToLower(name))
+	var slug strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug.WriteRune(r)
+		}
+	}
+	return slug.String()
+}
+
+// Returns the name in a list matching a name typed by a player
+func findName(names []string, name string) (string, bool) {
+	slug := nameSlug(name)
+	for _, candidate := range names {
+		if nameSlug(candidate) == slug {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// Returns the roster name of a character of a game
+func findCharacter(game GameTitle, name string) (string, error) {
+	character, ok := findName(rosters[game], name)
+	if !ok {
+		return "", fmt.Errorf("unknown %s character %q", game, name)
+	}
+	return character, nil
+}
+
+// Returns the name of a legal stage of a game
+func findStage(game GameTitle, name string) (string, error) {
+	stage, ok := findName(stageLists[game], name)
+	if !ok {
+		return "", fmt.Errorf("%q is not a legal %s stage (%s)", name, game, strings.Join(stageLists[game], ", "))
+	}
+	return stage, nil
+}
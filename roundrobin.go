@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Result of a player in a pool
+type Standing struct {
+	Player         string  `json:"player"`
+	Wins           int     `json:"wins"`
+	Losses         int     `json:"losses"`
+	GamesWon       int     `json:"games_won"`
+	GamesLost      int     `json:"games_lost"`
+	Byes           int     `json:"byes"`
+	Buchholz       int     `json:"buchholz"`
+	OpponentWinPct float64 `json:"opponent_win_pct"`
+}
+
+// Splits players into pools of balanced size, in snake order
+func splitIntoPools(players []string, numPools int) [][]string {
+	pools := make([][]string, numPools)
+	for i, player := range players {
+		pool := i % numPools
+		if (i/numPools)%2 == 1 {
+			pool = numPools - 1 - pool
+		}
+		pools[pool] = append(pools[pool], player)
+	}
+	return pools
+}
+
+// Returns the pairings of every round of a pool using the circle method,
+// so each player plays at most once per round and sits out at most once
+func poolSchedule(players []string) [][][2]string {
+	circle := make([]string, len(players))
+	copy(circle, players)
+	if len(circle)%2 == 1 {
+		circle = append(circle, "")
+	}
+
+	n := len(circle)
+	var rounds [][][2]string
+	for r := 0; r < n-1; r++ {
+		var pairs [][2]string
+		for m := 0; m < n/2; m++ {
+			p1, p2 := circle[m], circle[n-1-m]
+			if p1 == "" || p2 == "" {
+				continue
+			}
+			// Alternate sides of the fixed player so nobody is always player 1
+			if m == 0 && r%2 == 1 {
+				p1, p2 = p2, p1
+			}
+			pairs = append(pairs, [2]string{p1, p2})
+		}
+		rounds = append(rounds, pairs)
+
+		// Keep the first player fixed and rotate the others
+		last := circle[n-1]
+		copy(circle[2:], circle[1:n-1])
+		circle[1] = last
+	}
+	return rounds
+}
+
+// Builds the rounds of a round robin where every pair in a pool plays once.
+// Matches of a round are interleaved across pools, starting from a different
+// pool each round, so no pool always waits for a free table.
+func buildRoundRobin(pools [][]string) []Round {
+	schedules := make([][][][2]string, len(pools))
+	numRounds := 0
+	for p, pool := range pools {
+		schedules[p] = poolSchedule(pool)
+		if len(schedules[p]) > numRounds {
+			numRounds = len(schedules[p])
+		}
+	}
+
+	rounds := make([]Round, numRounds)
+	for r := range rounds {
+		rounds[r] = Round{
+			ID:      fmt.Sprintf("RR%d", r+1),
+			Number:  r + 1,
+			Bracket: BracketPools,
+		}
+
+		matchCounter := make([]int, len(pools))
+		for added := true; added; {
+			added = false
+			for k := range pools {
+				p := (k + r) % len(pools)
+				if r >= len(schedules[p]) || matchCounter[p] >= len(schedules[p][r]) {
+					continue
+				}
+				pair := schedules[p][r][matchCounter[p]]
+				matchCounter[p]++
+				rounds[r].Matches = append(rounds[r].Matches, Match{
+					ID:      fmt.Sprintf("P%dR%dM%d", p+1, r+1, matchCounter[p]),
+					Player1: pair[0],
+					Player2: pair[1],
+					Pool:    p + 1,
+					Bracket: BracketPools,
+				})
+				added = true
+			}
+		}
+	}
+	return rounds
+}
+
+// Computes the standings of a pool of a phase, ranked by set wins, then
+// head-to-head results between tied players, then game differential
+func computeStandings(tournament *Tournament, phase int, pool int) []Standing {
+	players := tournament.Phases[phase].Pools[pool-1]
+	standings := make(map[string]*Standing, len(players))
+	for _, player := range players {
+		standings[player] = &Standing{Player: player}
+	}
+
+	var matches []Match
+	for _, round := range tournament.Rounds {
+		if round.Phase != phase {
+			continue
+		}
+		for _, match := range round.Matches {
+			if match.Pool != pool || match.Winner == "" || match.Bye {
+				continue
+			}
+			matches = append(matches, match)
+			loser := matchLoser(match)
+			standings[match.Winner].Wins++
+			standings[loser].Losses++
+			winnerGames, loserGames := match.Player1Score, match.Player2Score
+			if match.Winner == match.Player2 {
+				winnerGames, loserGames = loserGames, winnerGames
+			}
+			standings[match.Winner].GamesWon += winnerGames
+			standings[match.Winner].GamesLost += loserGames
+			standings[loser].GamesWon += loserGames
+			standings[loser].GamesLost += winnerGames
+		}
+	}
+
+	// Head-to-head wins only count between players on the same number of wins
+	headToHead := make(map[string]int)
+	for _, match := range matches {
+		if standings[match.Winner].Wins == standings[matchLoser(match)].Wins {
+			headToHead[match.Winner]++
+		}
+	}
+
+	result := make([]Standing, 0, len(players))
+	for _, player := range players {
+		result = append(result, *standings[player])
+	}
+	sort.SliceStable(result, func(a, b int) bool {
+		sa, sb := result[a], result[b]
+		if sa.Wins != sb.Wins {
+			return sa.Wins > sb.Wins
+		}
+		if headToHead[sa.Player] != headToHead[sb.Player] {
+			return headToHead[sa.Player] > headToHead[sb.Player]
+		}
+		return sa.GamesWon-sa.GamesLost > sb.GamesWon-sb.GamesLost
+	})
+	return result
+}
+
+// Formats the standings of every pool of a phase
+func formatStandings(tournament *Tournament, phase int) string {
+	var result string
+	if tournament.Phases[phase].Format == FormatSwiss {
+		for rank, standing := range computeSwissStandings(tournament, phase) {
+			result += fmt.Sprintf("%d. %s - %d-%d (Buchholz %d, OWP %.0f%%)\n", rank+1, standing.Player,
+				standing.Wins, standing.Losses, standing.Buchholz, standing.OpponentWinPct*100)
+		}
+		return result
+	}
+	for p := range tournament.Phases[phase].Pools {
+		result += fmt.Sprintf("Pool %d:\n", p+1)
+		for rank, standing := range computeStandings(tournament, phase, p+1) {
+			result += fmt.Sprintf("%d. %s - %d-%d (games %+d)\n", rank+1, standing.Player,
+				standing.Wins, standing.Losses, standing.GamesWon-standing.GamesLost)
+		}
+		result += "\n"
+	}
+	return result
+}
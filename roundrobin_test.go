@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Starts a round robin phase with a single pool and the given number of tables
+func startTestPool(players []string, tables int) *Tournament {
+	tournament := &Tournament{
+		Phases: []Phase{{Format: FormatRoundRobin, Pools: [][]string{players}}},
+		Status: TournamentStatusOngoing,
+	}
+	for t := 0; t < tables; t++ {
+		tournament.Tables = append(tournament.Tables, Table{ID: fmt.Sprint(t), Available: true})
+	}
+	startPhase(tournament, buildRoundRobin(tournament.Phases[0].Pools))
+	return tournament
+}
+
+// Records the result of the pool match between two players, with the winner first
+func setPoolResult(t *testing.T, tournament *Tournament, winner string, loser string, winnerGames int, loserGames int) {
+	t.Helper()
+	for r := range tournament.Rounds {
+		for m := range tournament.Rounds[r].Matches {
+			match := &tournament.Rounds[r].Matches[m]
+			if match.Player1 == winner && match.Player2 == loser {
+				completeMatch(tournament, match, winner, winnerGames, loserGames)
+				return
+			}
+			if match.Player1 == loser && match.Player2 == winner {
+				completeMatch(tournament, match, winner, loserGames, winnerGames)
+				return
+			}
+		}
+	}
+	t.Fatalf("no match between %s and %s", winner, loser)
+}
+
+// Returns the players of standings in ranking order
+func standingOrder(standings []Standing) []string {
+	order := make([]string, len(standings))
+	for s, standing := range standings {
+		order[s] = standing.Player
+	}
+	return order
+}
+
+func TestPoolTablesSeatPlayersOnce(t *testing.T) {
+	// More tables than matches in a round, so later rounds could take them
+	tournament := startTestPool(seededPlayers(5), 4)
+
+	played := 0
+	for tournament.Status != TournamentStatusComplete {
+		seated := make(map[string]string)
+		var next *Match
+		for r := range tournament.Rounds {
+			for m := range tournament.Rounds[r].Matches {
+				match := &tournament.Rounds[r].Matches[m]
+				if !isMatchReady(*match) || match.TableID == "" {
+					continue
+				}
+				for _, player := range []string{match.Player1, match.Player2} {
+					if other, ok := seated[player]; ok {
+						t.Fatalf("%s is seated for %s and %s", player, other, match.ID)
+					}
+					seated[player] = match.ID
+				}
+				if next == nil {
+					next = match
+				}
+			}
+		}
+		if next == nil {
+			t.Fatalf("no match is seated after %d matches", played)
+		}
+		completeMatch(tournament, next, next.Player1, 2, 0)
+		played++
+	}
+	if played != 10 {
+		t.Errorf("expected 10 matches, got %d", played)
+	}
+}
+
+func TestStandingsGameDifferential(t *testing.T) {
+	// Every player wins once and beats a tied player, games decide
+	tournament := startTestPool([]string{"ana", "bob", "cid"}, 0)
+	setPoolResult(t, tournament, "ana", "bob", 2, 0)
+	setPoolResult(t, tournament, "bob", "cid", 2, 1)
+	setPoolResult(t, tournament, "cid", "ana", 2, 1)
+
+	standings := computeStandings(tournament, 0, 1)
+	want := []string{"ana", "cid", "bob"}
+	for s, player := range standingOrder(standings) {
+		if player != want[s] {
+			t.Fatalf("expected %v, got %v", want, standingOrder(standings))
+		}
+	}
+	if standings[0].GamesWon != 3 || standings[0].GamesLost != 2 {
+		t.Errorf("ana has games %d-%d, expected 3-2", standings[0].GamesWon, standings[0].GamesLost)
+	}
+}
+
+func TestStandingsHeadToHead(t *testing.T) {
+	// ana and dan win their sets against bob and cid, with worse game differentials
+	tournament := startTestPool([]string{"ana", "bob", "cid", "dan"}, 0)
+	setPoolResult(t, tournament, "ana", "bob", 2, 1)
+	setPoolResult(t, tournament, "ana", "dan", 2, 1)
+	setPoolResult(t, tournament, "bob", "cid", 2, 0)
+	setPoolResult(t, tournament, "bob", "dan", 2, 0)
+	setPoolResult(t, tournament, "cid", "ana", 2, 0)
+	setPoolResult(t, tournament, "dan", "cid", 2, 1)
+
+	standings := computeStandings(tournament, 0, 1)
+	want := []string{"ana", "bob", "dan", "cid"}
+	for s, player := range standingOrder(standings) {
+		if player != want[s] {
+			t.Fatalf("expected %v, got %v", want, standingOrder(standings))
+		}
+	}
+	if standings[0].Wins != 2 || standings[3].Losses != 2 {
+		t.Errorf("got %d wins for ana and %d losses for cid", standings[0].Wins, standings[3].Losses)
+	}
+}
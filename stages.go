@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Prefix of the custom ID of stage buttons, followed by the match ID and the stage
+const stageButtonPrefix = "stage"
+
+// Stage rules of a tournament. Game 1 is played on a starter stage chosen by
+// striking, later games on a starter or counterpick stage chosen by the loser
+// of the previous game after the winner banned CounterpickBans stages.
+type Ruleset struct {
+	Starters        []string `json:"starters"`
+	Counterpicks    []string `json:"counterpicks"`
+	CounterpickBans int      `json:"counterpick_bans"`
+	DSR             bool     `json:"dsr"`
+}
+
+// Stage selection in progress for the next game of a set
+type StageSelection struct {
+	Game     int      `json:"game"`
+	Banned   []string `json:"banned"`
+	Turn     string   `json:"turn"`
+	BansLeft int      `json:"bans_left"`
+	Stage    string   `json:"stage"`
+}
+
+// Returns the usual stage rules of a game
+func defaultRuleset(game GameTitle) Ruleset {
+	if game == GameMelee {
+		return Ruleset{
+			Starters:        []string{"Battlefield", "Final Destination", "Dream Land N64", "Yoshi's Story", "Fountain of Dreams"},
+			Counterpicks:    []string{"Pokémon Stadium"},
+			CounterpickBans: 2,
+			DSR:             true,
+		}
+	}
+	return Ruleset{
+		Starters:        []string{"Battlefield", "Final Destination", "Pokémon Stadium 2", "Smashville", "Town and City"},
+		Counterpicks:    []string{"Small Battlefield", "Kalos Pokémon League", "Lylat Cruise", "Yoshi's Story", "Hollow Bastion"},
+		CounterpickBans: 3,
+		DSR:             true,
+	}
+}
+
+// Returns the stage rules of a tournament, the game's usual rules when none were set
+func tournamentRuleset(tournament *Tournament) Ruleset {
+	if len(tournament.Ruleset.Starters) == 0 {
+		return defaultRuleset(tournamentGame(tournament))
+	}
+	return tournament.Ruleset
+}
+
+// Replaces the stage rules of the current tournament. Stage lists are comma separated.
+func setRuleset(db *Database, starters string, counterpicks string, bans int, dsr bool) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+
+	ruleset := Ruleset{CounterpickBans: bans, DSR: dsr}
+	var err error
+	if ruleset.Starters, err = parseStageList(tournamentGame(tournament), starters); err != nil {
+		return err
+	}
+	if ruleset.Counterpicks, err = parseStageList(tournamentGame(tournament), counterpicks); err != nil {
+		return err
+	}
+	if len(ruleset.Starters) == 0 {
+		return fmt.Errorf("at least one starter stage is required")
+	}
+	if bans < 0 || bans >= len(ruleset.Starters)+len(ruleset.Counterpicks) {
+		return fmt.Errorf("too many bans, at least one stage must be left to pick")
+	}
+
+	recordEvent(db, EventRulesetSet, "Ruleset updated")
+	tournament.Ruleset = ruleset
+	log.Print("Ruleset updated successfully")
+	return saveTournament(db, tournament)
+}
+
+// Formats the stage rules of a tournament
+func formatRuleset(ruleset Ruleset) string {
+	result := fmt.Sprintf("Starters: %s\n", strings.Join(ruleset.Starters, ", "))
+	if len(ruleset.Counterpicks) > 0 {
+		result += fmt.Sprintf("Counterpicks: %s\n", strings.Join(ruleset.Counterpicks, ", "))
+	}
+	result += fmt.Sprintf("Counterpick bans: %d\n", ruleset.CounterpickBans)
+	if ruleset.DSR {
+		result += "Dave's Stupid Rule: on\n"
+	}
+	return result
+}
+
+// Parses a comma separated list of stages of a game
+func parseStageList(game GameTitle, list string) ([]string, error) {
+	var stages []string
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		stage, err := findStage(game, name)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// Returns how many stages a player strikes on a turn of game 1: one for the
+// first player, then two per turn, and one again when a single stage would be left
+// (1-2-1 with five starters)
+func strikeCount(starters int, banned int) int {
+	if banned == 0 {
+		return 1
+	}
+	return min(2, starters-1-banned)
+}
+
+// Returns the other player of a match
+func opponent(match Match, player string) string {
+	if player == match.Player1 {
+		return match.Player2
+	}
+	return match.Player1
+}
+
+// Starts the stage selection of the next game of a set. Player 1 strikes first
+// in game 1, later the winner of the previous game bans.
+func newStageSelection(tournament *Tournament, match *Match) {
+	ruleset := tournamentRuleset(tournament)
+	selection := &StageSelection{Game: len(match.Games) + 1}
+	if selection.Game == 1 {
+		selection.Turn = match.Player1
+		selection.BansLeft = strikeCount(len(ruleset.Starters), 0)
+		if len(ruleset.Starters) == 1 {
+			selection.BansLeft = 0
+			selection.Stage = ruleset.Starters[0]
+		}
+	} else {
+		selection.Turn = match.Games[len(match.Games)-1].Winner
+		selection.BansLeft = ruleset.CounterpickBans
+		if selection.BansLeft == 0 {
+			selection.Turn = opponent(*match, selection.Turn)
+		}
+	}
+	match.StageSelection = selection
+}
+
+// Returns the stages a game of a set can be played on
+func stagePool(ruleset Ruleset, game int) []string {
+	if game == 1 {
+		return ruleset.Starters
+	}
+	return append(append([]string{}, ruleset.Starters...), ruleset.Counterpicks...)
+}
+
+// Reports whether a player may not pick a stage because they already won on it
+// in the set (Dave's Stupid Rule)
+func blockedByDSR(ruleset Ruleset, match Match, player string, stage string) bool {
+	if !ruleset.DSR {
+		return false
+	}
+	for _, game := range match.Games {
+		if game.Winner == player && game.Stage == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Starts the stage selection of a match, or keeps the one in progress
+func startStageSelection(db *Database, matchID string) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return fmt.Errorf("match not found")
+	}
+	if !isMatchReady(*match) {
+		return fmt.Errorf("this match is not being played")
+	}
+	if match.StageSelection != nil {
+		return nil
+	}
+	newStageSelection(tournament, match)
+	log.Print("Stage selection started successfully")
+	return saveTournament(db, tournament)
+}
+
+// Bans or picks a stage for the next game of a set on behalf of a player
+func selectStage(db *Database, matchID string, player string, stage string) error {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return fmt.Errorf("no active tournament")
+	}
+	match := findMatch(tournament, matchID)
+	if match == nil {
+		return fmt.Errorf("match not found")
+	}
+	selection := match.StageSelection
+	if selection == nil || selection.Stage != "" || !isMatchReady(*match) {
+		return fmt.Errorf("no stage selection in progress for this match")
+	}
+	if !strings.EqualFold(player, selection.Turn) {
+		return fmt.Errorf("it is %s's turn to choose", selection.Turn)
+	}
+
+	ruleset := tournamentRuleset(tournament)
+	pool := stagePool(ruleset, selection.Game)
+	picked, ok := findName(pool, stage)
+	if !ok {
+		return fmt.Errorf("%s cannot be played in game %d", stage, selection.Game)
+	}
+	stage = picked
+	if _, banned := findName(selection.Banned, stage); banned {
+		return fmt.Errorf("%s is already banned", stage)
+	}
+
+	if selection.BansLeft == 0 {
+		if blockedByDSR(ruleset, *match, selection.Turn, stage) {
+			return fmt.Errorf("%s already won on %s in this set", selection.Turn, stage)
+		}
+		selection.Stage = stage
+		log.Print("Stage picked successfully")
+		return saveTournament(db, tournament)
+	}
+
+	selection.Banned = append(selection.Banned, stage)
+	selection.BansLeft--
+	if selection.BansLeft == 0 {
+		selection.Turn = opponent(*match, selection.Turn)
+		if selection.Game == 1 {
+			selection.BansLeft = strikeCount(len(pool), len(selection.Banned))
+			// The last starter standing is the stage of game 1
+			if selection.BansLeft == 0 {
+				for _, s := range pool {
+					if _, banned := findName(selection.Banned, s); !banned {
+						selection.Stage = s
+					}
+				}
+			}
+		}
+	}
+	log.Print("Stage banned successfully")
+	return saveTournament(db, tournament)
+}
+
+// Returns the description and buttons of the stage selection of a match
+func stageSelectionMessage(tournament *Tournament, match Match) (string, []discordgo.MessageComponent) {
+	selection := match.StageSelection
+	if selection == nil {
+		return "No stage selection in progress for this match.", nil
+	}
+	if selection.Stage != "" {
+		return fmt.Sprintf("Match %s: %s vs %s\nGame %d will be played on **%s**.",
+			match.ID, match.Player1, match.Player2, selection.Game, selection.Stage), nil
+	}
+
+	ruleset := tournamentRuleset(tournament)
+	description := fmt.Sprintf("Match %s: %s vs %s - Game %d\n", match.ID, match.Player1, match.Player2, selection.Game)
+	if selection.BansLeft > 0 {
+		description += fmt.Sprintf("%s, ban %d stage(s).", selection.Turn, selection.BansLeft)
+	} else {
+		description += fmt.Sprintf("%s, pick the stage.", selection.Turn)
+	}
+	if len(selection.Banned) > 0 {
+		description += "\nBanned: " + strings.Join(selection.Banned, ", ")
+	}
+
+	var rows []discordgo.MessageComponent
+	var row discordgo.ActionsRow
+	for _, stage := range stagePool(ruleset, selection.Game) {
+		_, banned := findName(selection.Banned, stage)
+		button := discordgo.Button{
+			Label:    stage,
+			Style:    discordgo.PrimaryButton,
+			CustomID: fmt.Sprintf("%s:%s:%s", stageButtonPrefix, match.ID, stage),
+		}
+		if banned {
+			button.Style = discordgo.DangerButton
+			button.Disabled = true
+		} else if selection.BansLeft == 0 && blockedByDSR(ruleset, match, selection.Turn, stage) {
+			button.Style = discordgo.SecondaryButton
+			button.Disabled = true
+		}
+		row.Components = append(row.Components, button)
+		if len(row.Components) == 5 {
+			rows = append(rows, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 {
+		rows = append(rows, row)
+	}
+	return description, rows
+}
+
+// Sends the stage selection of a match, either as a new message or by updating
+// the message whose button was clicked
+func sendStageSelection(s *discordgo.Session, i *discordgo.InteractionCreate, responseType discordgo.InteractionResponseType, header string, tournament *Tournament, match Match) {
+	description, components := stageSelectionMessage(tournament, match)
+	if header != "" {
+		description = header + "\n\n" + description
+	}
+	if components == nil {
+		// Discord keeps the old buttons when the list is left out
+		components = []discordgo.MessageComponent{}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: responseType,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "Stage selection",
+					Description: description,
+					Color:       0x00FF00,
+				},
+			},
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Error sending stage selection: %v", err)
+	}
+}
+
+// Handles a click on a stage button
+func handleStageButton(s *discordgo.Session, i *discordgo.InteractionCreate, db *Database, matchID string, stage string) {
+	user := interactionUser(i)
+	if user == nil {
+		return
+	}
+	if err := selectStage(db, matchID, playerNameForUser(db, user), stage); err != nil {
+		sendEphemeralResponse(s, i, "Erreur", err.Error(), 0xFF0000)
+		return
+	}
+	tournament := getCurrentTournament(db)
+	sendStageSelection(s, i, discordgo.InteractionResponseUpdateMessage, "", tournament, *findMatch(tournament, matchID))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// In-memory data of a server. Changes run one at a time on a working copy, and
+// readers get the last saved version, which is never modified once published.
+type guildState struct {
+	// Held for the whole of a change, from loading to the last save
+	mu    sync.Mutex
+	saved atomic.Pointer[Database]
+	// Held while the match threads of the server are opened and archived on
+	// Discord, which changes do not wait for
+	threads sync.Mutex
+}
+
+// Owns the data of every server the bot is in
+type stateOwner struct {
+	mu     sync.Mutex
+	guilds map[string]*guildState
+}
+
+var state = &stateOwner{guilds: make(map[string]*guildState)}
+
+// Returns the state of a server, created on first use
+func (o *stateOwner) guild(guildID string) *guildState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	g := o.guilds[guildID]
+	if g == nil {
+		g = &guildState{}
+		o.guilds[guildID] = g
+	}
+	return g
+}
+
+// Returns the last saved data of a server, loading it the first time
+func (g *guildState) load(guildID string) (*Database, error) {
+	if db := g.saved.Load(); db != nil {
+		return db, nil
+	}
+	db, err := loadDatabase(guildID)
+	if err != nil {
+		return nil, err
+	}
+	g.saved.Store(db)
+	return db, nil
+}
+
+// Locks the data of a server for a change and returns a working copy of it.
+// Other changes of the server wait until unlock is called; the copy only
+// becomes visible to readers when it is saved.
+func (o *stateOwner) acquire(guildID string) (db *Database, unlock func(), err error) {
+	if guildID == "" {
+		return nil, nil, fmt.Errorf("this bot can only be used in a server")
+	}
+	g := o.guild(guildID)
+	g.mu.Lock()
+	if g.saved.Load() == nil {
+		// Loaded under the lock, so a server is only read once
+		if _, err := g.load(guildID); err != nil {
+			g.mu.Unlock()
+			return nil, nil, err
+		}
+	}
+	db, err = cloneDatabase(g.saved.Load())
+	if err != nil {
+		g.mu.Unlock()
+		return nil, nil, err
+	}
+	db.savedEvents = len(db.Events)
+	return db, g.mu.Unlock, nil
+}
+
+// Locks the match threads of a server, so two follow-ups of its changes never
+// open the same thread twice. Changes of its data go on meanwhile.
+func (o *stateOwner) lockThreads(guildID string) (unlock func()) {
+	g := o.guild(guildID)
+	g.threads.Lock()
+	return g.threads.Unlock
+}
+
+// Returns the last saved data of a server. It must not be modified.
+func (o *stateOwner) snapshot(guildID string) (*Database, error) {
+	if guildID == "" {
+		return nil, fmt.Errorf("this bot can only be used in a server")
+	}
+	g := o.guild(guildID)
+	if db := g.saved.Load(); db != nil {
+		return db, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.load(guildID)
+}
+
+// Makes saved data visible to readers and to the next change
+func (o *stateOwner) publish(db *Database) {
+	saved, err := cloneDatabase(db)
+	if err != nil {
+		// Force a reload from the store rather than keeping stale data
+		o.guild(db.GuildID).saved.Store(nil)
+		return
+	}
+	o.guild(db.GuildID).saved.Store(saved)
+}
+
+// Returns a deep copy of the data of a server
+func cloneDatabase(db *Database) (*Database, error) {
+	data, err := json.Marshal(db)
+	if err != nil {
+		return nil, fmt.Errorf("error copying database: %w", err)
+	}
+	clone := &Database{}
+	if err := json.Unmarshal(data, clone); err != nil {
+		return nil, fmt.Errorf("error copying database: %w", err)
+	}
+	clone.GuildID = db.GuildID
+	return clone, nil
+}
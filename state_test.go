@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Swaps in a fresh JSON store and state in a temporary directory
+func useTestStore(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	previous := dataStore
+	dataStore = newJSONStore("database.json")
+	state = &stateOwner{guilds: make(map[string]*guildState)}
+	t.Cleanup(func() {
+		dataStore = previous
+		state = &stateOwner{guilds: make(map[string]*guildState)}
+		os.Chdir(wd)
+	})
+}
+
+// Starts a tournament of n players in a fresh JSON store in a temporary directory
+func startTestTournament(t *testing.T, guildID string, n int) {
+	t.Helper()
+	useTestStore(t)
+
+	db, unlock, err := state.acquire(guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	for p := 1; p <= n; p++ {
+		if err := addPlayer(db, Player{ID: fmt.Sprint(p), Username: fmt.Sprintf("player%02d", p)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := addTable(db, n/2); err != nil {
+		t.Fatal(err)
+	}
+	if err := startTournament(db, TournamentOptions{Format: FormatSingleElimination}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParallelMatchReports(t *testing.T) {
+	startTestTournament(t, "guild", 16)
+
+	snapshot, err := state.snapshot("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := getCurrentTournament(snapshot).Rounds[0].Matches
+	if len(first) != 8 {
+		t.Fatalf("expected 8 first round matches, got %d", len(first))
+	}
+
+	var wg sync.WaitGroup
+	for _, match := range first {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			db, unlock, err := state.acquire("guild")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			if err := updateMatchResult(db, match.ID, match.Player1, ""); err != nil {
+				t.Errorf("match %s: %v", match.ID, err)
+			}
+		}()
+		// Readers like the web interface run alongside the reports
+		go func() {
+			defer wg.Done()
+			db, err := state.snapshot("guild")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if getCurrentTournament(db) == nil {
+				t.Error("snapshot without tournament")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every result must reach the file, none overwritten by another report
+	db, err := newJSONStore("database.json").Load("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, match := range getCurrentTournament(db).Rounds[0].Matches {
+		if match.Winner != match.Player1 {
+			t.Errorf("result of match %s was lost", match.ID)
+		}
+	}
+}
+
+func TestWebBracketServedOnceStarted(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+
+	get := func(query string) int {
+		recorder := httptest.NewRecorder()
+		serveTournamentData(recorder, httptest.NewRequest(http.MethodGet, "/api/tournament"+query, nil))
+		return recorder.Code
+	}
+	if code := get("?guild=guild"); code != http.StatusNotFound {
+		t.Fatalf("the bracket is served before being started, got %d", code)
+	}
+	if code := get(""); code != http.StatusNotFound {
+		t.Fatalf("the single server bracket is served before being started, got %d", code)
+	}
+
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setWebBracket(db, true)
+	unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := get("?guild=guild"); code != http.StatusOK {
+		t.Errorf("the started bracket is not served, got %d", code)
+	}
+	if code := get("?guild=other"); code != http.StatusNotFound {
+		t.Errorf("an unknown server is served, got %d", code)
+	}
+}
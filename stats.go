@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Games played and won with a character or on a stage
+type GameRecord struct {
+	Name   string
+	Played int
+	Won    int
+}
+
+// Adds a game to the record of a name
+func addRecord(records map[string]*GameRecord, name string, won bool) {
+	if name == "" {
+		return
+	}
+	if records[name] == nil {
+		records[name] = &GameRecord{Name: name}
+	}
+	records[name].Played++
+	if won {
+		records[name].Won++
+	}
+}
+
+// Returns the records sorted from the most played
+func sortedRecords(records map[string]*GameRecord) []GameRecord {
+	result := make([]GameRecord, 0, len(records))
+	for _, record := range records {
+		result = append(result, *record)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Played != result[b].Played {
+			return result[a].Played > result[b].Played
+		}
+		return result[a].Name < result[b].Name
+	})
+	return result
+}
+
+// Returns the matches of every tournament, or only the ones of a player, which
+// the store looks up without going through every tournament
+func statsMatches(db *Database, player string) ([]Match, error) {
+	if player != "" {
+		return dataStore.PlayerMatches(db.GuildID, player)
+	}
+	var matches []Match
+	for _, tournament := range db.Tournaments {
+		for _, round := range tournament.Rounds {
+			matches = append(matches, round.Matches...)
+		}
+	}
+	return matches, nil
+}
+
+// Collects character and stage records of every game of the matches. With a
+// player set, only the games of that player are counted, from their side.
+func collectGameRecords(matches []Match, player string) (map[string]*GameRecord, map[string]*GameRecord) {
+	characters := make(map[string]*GameRecord)
+	stages := make(map[string]*GameRecord)
+	for _, match := range matches {
+		for _, game := range match.Games {
+			if player == "" {
+				addRecord(characters, game.WinnerCharacter, true)
+				addRecord(characters, game.LoserCharacter, false)
+				addRecord(stages, game.Stage, true)
+				continue
+			}
+			if player != match.Player1 && player != match.Player2 {
+				continue
+			}
+			won := game.Winner == player
+			character := game.LoserCharacter
+			if won {
+				character = game.WinnerCharacter
+			}
+			addRecord(characters, character, won)
+			addRecord(stages, game.Stage, won)
+		}
+	}
+	return characters, stages
+}
+
+// Formats the most played characters and the stage win rates, of a player or of everyone
+func formatStats(db *Database, player string) (string, error) {
+	matches, err := statsMatches(db, player)
+	if err != nil {
+		return "", err
+	}
+	characters, stages := collectGameRecords(matches, player)
+	if len(characters) == 0 && len(stages) == 0 {
+		return "No game with characters or stages recorded yet.", nil
+	}
+
+	var result string
+	result += "Most played characters:\n"
+	for k, record := range sortedRecords(characters) {
+		if k == 10 {
+			break
+		}
+		result += fmt.Sprintf("%d. %s - %d games (%.0f%% won)\n", k+1, record.Name, record.Played, 100*float64(record.Won)/float64(record.Played))
+	}
+
+	result += "\nStages:\n"
+	for _, record := range sortedRecords(stages) {
+		// Every game on a stage is won by someone, so the win rate only means something for a player
+		if player == "" {
+			result += fmt.Sprintf("- %s - %d games\n", record.Name, record.Played)
+			continue
+		}
+		result += fmt.Sprintf("- %s - %d/%d won (%.0f%%)\n", record.Name, record.Won, record.Played, 100*float64(record.Won)/float64(record.Played))
+	}
+	return result, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Persists the data of every server the bot is in
+type Store interface {
+	// Returns the IDs of the servers with saved data
+	Guilds() ([]string, error)
+	// Loads the data of a server, empty when it has none yet
+	Load(guildID string) (*Database, error)
+	// Gives the data saved before multi-server support to a server without data of its own
+	ClaimLegacy(guildID string) error
+	// Replaces every piece of data of a server
+	Save(db *Database) error
+	// The following saves also add the events of the change to the log of the
+	// server, in the same write, and drop the history of events too old to be undone
+	SavePlayers(guildID string, players []Player, events []Event) error
+	SaveTables(guildID string, tables []Table, events []Event) error
+	// Adds or replaces a tournament of a server
+	SaveTournament(guildID string, tournament Tournament, events []Event) error
+	SaveSettings(guildID string, settings Settings, events []Event) error
+	// Returns a match of the current tournament of a server, nil when there is none with this ID
+	FindMatch(guildID string, matchID string) (*Match, error)
+	// Returns the matches of a player in every tournament of a server
+	PlayerMatches(guildID string, player string) ([]Match, error)
+	Close() error
+}
+
+var (
+	errNoLegacyData = errors.New("there is no data saved before multi-server support")
+	errGuildHasData = errors.New("this server already has players, tables or tournaments")
+)
+
+// Reports whether a server has players, tables or tournaments
+func hasData(db *Database) bool {
+	return db != nil && (len(db.Players) > 0 || len(db.Tables) > 0 || len(db.Tournaments) > 0)
+}
+
+// Store used by the bot, replaced at startup when another backend is configured
+var dataStore Store = newJSONStore("database.json")
+
+// Opens the store selected by the STORAGE_BACKEND environment variable: json
+// (default) or sqlite, whose file is set by SQLITE_PATH
+func openStore() (Store, error) {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "", "json":
+		return newJSONStore("database.json"), nil
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "smashbot.db"
+		}
+		store, err := openSQLiteStore(path, newJSONStore("database.json"))
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", os.Getenv("STORAGE_BACKEND"))
+}
+
+// Number of previous versions of the JSON file kept next to it, as
+// database.json.1 (newest) to database.json.5
+const snapshotCount = 5
+
+// Data of every server, as written in the JSON file
+type Storage struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Guilds        map[string]*Database `json:"guilds"`
+}
+
+// Store keeping everything in a single JSON file, rewritten on every change
+type jsonStore struct {
+	path string
+	// Serializes read-modify-write cycles of the file within the bot
+	mu sync.Mutex
+}
+
+func newJSONStore(path string) *jsonStore {
+	return &jsonStore{path: path}
+}
+
+// Reads every server's data from the file. When the file is corrupt, the data
+// comes from the newest valid snapshot, which replaces the file.
+func (s *jsonStore) read() (*Storage, error) {
+	file, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Println("Database file does not exist. Creating a new one.")
+			return &Storage{Guilds: make(map[string]*Database)}, nil
+		}
+		log.Printf("Error reading database file: %v", err)
+		return nil, fmt.Errorf("error reading database file: %w", err)
+	}
+
+	storage, version, err := parseStorage(file)
+	if err == nil && version != currentSchemaVersion {
+		// Keep the file as it was before migrating, then save it upgraded
+		backup := migrationBackupPath(s.path, version)
+		if err := writeFileAtomic(backup, file); err != nil {
+			return nil, err
+		}
+		if err := s.write(storage); err != nil {
+			return nil, err
+		}
+		log.Printf("Database migrated from schema version %d to %d, backup saved as %s", version, currentSchemaVersion, backup)
+	}
+	if err == nil {
+		return storage, nil
+	}
+	log.Printf("Error unmarshalling database: %v", err)
+	if errors.Is(err, errNewerSchema) {
+		return nil, err
+	}
+	for n := 1; n <= snapshotCount; n++ {
+		snapshot, readErr := os.ReadFile(s.snapshotPath(n))
+		if readErr != nil {
+			continue
+		}
+		storage, _, parseErr := parseStorage(snapshot)
+		if parseErr != nil {
+			log.Printf("Snapshot %s is corrupt too: %v", s.snapshotPath(n), parseErr)
+			continue
+		}
+		if err := s.write(storage); err != nil {
+			return nil, err
+		}
+		log.Printf("Database recovered from snapshot %s", s.snapshotPath(n))
+		return storage, nil
+	}
+	return nil, fmt.Errorf("error unmarshalling database: %w", err)
+}
+
+// Writes every server's data to the file
+func (s *jsonStore) write(storage *Storage) error {
+	storage.SchemaVersion = currentSchemaVersion
+	file, err := json.MarshalIndent(storage, "", "  ")
+	if err != nil {
+		log.Printf("Error marshalling database: %v", err)
+		return fmt.Errorf("error marshalling database: %w", err)
+	}
+	if err := s.rotateSnapshots(); err != nil {
+		log.Printf("Error saving database snapshot: %v", err)
+	}
+	if err := writeFileAtomic(s.path, file); err != nil {
+		log.Printf("Error writing database file: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Returns the path of the nth newest snapshot of the file
+func (s *jsonStore) snapshotPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+// Keeps the current file as the newest snapshot, shifting older ones and
+// dropping the oldest. A corrupt file is not kept, so snapshots stay valid.
+func (s *jsonStore) rotateSnapshots() error {
+	current, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, _, err := parseStorage(current); err != nil {
+		return nil
+	}
+	for n := snapshotCount - 1; n >= 1; n-- {
+		err := os.Rename(s.snapshotPath(n), s.snapshotPath(n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return writeFileAtomic(s.snapshotPath(1), current)
+}
+
+// Replaces a file without ever leaving it half written: the data goes to a
+// temporary file in the same directory, is flushed to disk, then renamed over it
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	temp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	// Removing fails harmlessly once the file has been renamed
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return fmt.Errorf("error syncing temporary file: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file: %w", err)
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return fmt.Errorf("error setting file permissions: %w", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	// Flush the rename itself, not supported on every system
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Applies a change to the data of a server and writes the file
+func (s *jsonStore) update(guildID string, change func(db *Database)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storage, err := s.read()
+	if err != nil {
+		return err
+	}
+	db := storage.Guilds[guildID]
+	if db == nil {
+		db = &Database{GuildID: guildID}
+		storage.Guilds[guildID] = db
+	}
+	change(db)
+	return s.write(storage)
+}
+
+func (s *jsonStore) Guilds() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storage, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	guilds := make([]string, 0, len(storage.Guilds))
+	for guildID := range storage.Guilds {
+		guilds = append(guilds, guildID)
+	}
+	return guilds, nil
+}
+
+func (s *jsonStore) Load(guildID string) (*Database, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storage, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if db, ok := storage.Guilds[guildID]; ok {
+		return db, nil
+	}
+	return &Database{GuildID: guildID}, nil
+}
+
+func (s *jsonStore) ClaimLegacy(guildID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	storage, err := s.read()
+	if err != nil {
+		return err
+	}
+	db := storage.Guilds[legacyGuildID]
+	if !hasData(db) {
+		return errNoLegacyData
+	}
+	if hasData(storage.Guilds[guildID]) {
+		return errGuildHasData
+	}
+	delete(storage.Guilds, legacyGuildID)
+	db.GuildID = guildID
+	storage.Guilds[guildID] = db
+	if err := s.write(storage); err != nil {
+		return err
+	}
+	log.Printf("Existing data assigned to guild %s", guildID)
+	return nil
+}
+
+func (s *jsonStore) Save(db *Database) error {
+	return s.update(db.GuildID, func(saved *Database) {
+		*saved = *db
+	})
+}
+
+func (s *jsonStore) SavePlayers(guildID string, players []Player, events []Event) error {
+	return s.update(guildID, func(db *Database) {
+		db.Players = players
+		appendEvents(db, events)
+	})
+}
+
+func (s *jsonStore) SaveTables(guildID string, tables []Table, events []Event) error {
+	return s.update(guildID, func(db *Database) {
+		db.Tables = tables
+		appendEvents(db, events)
+	})
+}
+
+func (s *jsonStore) SaveTournament(guildID string, tournament Tournament, events []Event) error {
+	return s.update(guildID, func(db *Database) {
+		appendEvents(db, events)
+		for t := range db.Tournaments {
+			if db.Tournaments[t].ID == tournament.ID {
+				db.Tournaments[t] = tournament
+				return
+			}
+		}
+		db.Tournaments = append(db.Tournaments, tournament)
+	})
+}
+
+func (s *jsonStore) SaveSettings(guildID string, settings Settings, events []Event) error {
+	return s.update(guildID, func(db *Database) {
+		db.Settings = settings
+		appendEvents(db, events)
+	})
+}
+
+// Adds events to the log of a server and drops the history of events too old to be undone
+func appendEvents(db *Database, events []Event) {
+	db.Events = append(db.Events, events...)
+	trimEventHistory(db.Events)
+}
+
+func (s *jsonStore) FindMatch(guildID string, matchID string) (*Match, error) {
+	db, err := s.Load(guildID)
+	if err != nil {
+		return nil, err
+	}
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil, nil
+	}
+	return findMatch(tournament, matchID), nil
+}
+
+func (s *jsonStore) PlayerMatches(guildID string, player string) ([]Match, error) {
+	db, err := s.Load(guildID)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Match
+	for _, tournament := range db.Tournaments {
+		for _, round := range tournament.Rounds {
+			for _, match := range round.Matches {
+				if match.Player1 == player || match.Player2 == player {
+					matches = append(matches, match)
+				}
+			}
+		}
+	}
+	return matches, nil
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	_ "modernc.org/sqlite"
+)
+
+// Tables of the SQLite store. Tournaments are kept as JSON documents, and their
+// matches are copied to their own table so they can be looked up by ID or player.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS players (
+	guild_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	id TEXT NOT NULL,
+	username TEXT NOT NULL,
+	seed INTEGER NOT NULL,
+	rating INTEGER NOT NULL,
+	discord_id TEXT NOT NULL,
+	PRIMARY KEY (guild_id, position)
+);
+CREATE INDEX IF NOT EXISTS players_username ON players (guild_id, username);
+CREATE TABLE IF NOT EXISTS venue_tables (
+	guild_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	id TEXT NOT NULL,
+	available INTEGER NOT NULL,
+	match_id TEXT NOT NULL,
+	PRIMARY KEY (guild_id, position)
+);
+CREATE TABLE IF NOT EXISTS tournaments (
+	guild_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (guild_id, id)
+);
+CREATE TABLE IF NOT EXISTS matches (
+	guild_id TEXT NOT NULL,
+	tournament_id TEXT NOT NULL,
+	match_id TEXT NOT NULL,
+	player1 TEXT NOT NULL,
+	player2 TEXT NOT NULL,
+	winner TEXT NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (guild_id, tournament_id, match_id)
+);
+CREATE INDEX IF NOT EXISTS matches_id ON matches (guild_id, match_id);
+CREATE INDEX IF NOT EXISTS matches_player1 ON matches (guild_id, player1);
+CREATE INDEX IF NOT EXISTS matches_player2 ON matches (guild_id, player2);
+CREATE TABLE IF NOT EXISTS settings (
+	guild_id TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS events (
+	guild_id TEXT NOT NULL,
+	id INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	before TEXT,
+	PRIMARY KEY (guild_id, id)
+);
+`
+
+// Tables holding data of a server, in the order they are cleared
+var sqliteGuildTables = []string{"players", "venue_tables", "tournaments", "matches", "settings", "events"}
+
+// Store keeping data in an embedded SQLite database. Every save runs in a
+// transaction, so a failed write never leaves half of a change behind.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Opens or creates a SQLite store. When it is empty, the data of the JSON
+// store is imported so switching backends keeps existing tournaments.
+func openSQLiteStore(path string, previous *jsonStore) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite database: %w", err)
+	}
+	// A single connection keeps transactions from different handlers in line
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating sqlite tables: %w", err)
+	}
+
+	store := &sqliteStore{db: db}
+	if previous != nil {
+		if err := store.importJSON(previous); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	log.Printf("SQLite database %s opened successfully", path)
+	return store, nil
+}
+
+// Copies every server of a JSON store into an empty SQLite store
+func (s *sqliteStore) importJSON(previous *jsonStore) error {
+	guilds, err := s.Guilds()
+	if err != nil || len(guilds) > 0 {
+		return err
+	}
+	storage, err := previous.read()
+	if err != nil {
+		return err
+	}
+	for guildID, db := range storage.Guilds {
+		db.GuildID = guildID
+		if err := s.Save(db); err != nil {
+			return err
+		}
+		log.Printf("Guild %s imported from %s", guildID, previous.path)
+	}
+	return nil
+}
+
+// Runs a change in a transaction, rolled back when it fails
+func (s *sqliteStore) inTransaction(change func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	if err := change(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Guilds() ([]string, error) {
+	rows, err := s.db.Query(`SELECT guild_id FROM players UNION SELECT guild_id FROM venue_tables
+		UNION SELECT guild_id FROM tournaments UNION SELECT guild_id FROM settings`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing guilds: %w", err)
+	}
+	defer rows.Close()
+	var guilds []string
+	for rows.Next() {
+		var guildID string
+		if err := rows.Scan(&guildID); err != nil {
+			return nil, err
+		}
+		guilds = append(guilds, guildID)
+	}
+	return guilds, rows.Err()
+}
+
+func (s *sqliteStore) Load(guildID string) (*Database, error) {
+	return s.load(guildID)
+}
+
+func (s *sqliteStore) ClaimLegacy(guildID string) error {
+	legacy, err := s.load(legacyGuildID)
+	if err != nil {
+		return err
+	}
+	if !hasData(legacy) {
+		return errNoLegacyData
+	}
+	db, err := s.load(guildID)
+	if err != nil {
+		return err
+	}
+	if hasData(db) {
+		return errGuildHasData
+	}
+
+	err = s.inTransaction(func(tx *sql.Tx) error {
+		for _, table := range sqliteGuildTables {
+			// Settings and events the server already saved give way to the claimed ones
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE guild_id = ?", guildID); err != nil {
+				return fmt.Errorf("error claiming %s: %w", table, err)
+			}
+			if _, err := tx.Exec("UPDATE "+table+" SET guild_id = ? WHERE guild_id = ?", guildID, legacyGuildID); err != nil {
+				return fmt.Errorf("error claiming %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Existing data assigned to guild %s", guildID)
+	return nil
+}
+
+// Reads the rows of a server
+func (s *sqliteStore) load(guildID string) (*Database, error) {
+	db := &Database{GuildID: guildID}
+
+	rows, err := s.db.Query("SELECT id, username, seed, rating, discord_id FROM players WHERE guild_id = ? ORDER BY position", guildID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading players: %w", err)
+	}
+	for rows.Next() {
+		var player Player
+		if err := rows.Scan(&player.ID, &player.Username, &player.Seed, &player.Rating, &player.DiscordID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		db.Players = append(db.Players, player)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query("SELECT id, available, match_id FROM venue_tables WHERE guild_id = ? ORDER BY position", guildID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tables: %w", err)
+	}
+	for rows.Next() {
+		var table Table
+		if err := rows.Scan(&table.ID, &table.Available, &table.MatchID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		db.Tables = append(db.Tables, table)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query("SELECT data FROM tournaments WHERE guild_id = ? ORDER BY position", guildID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tournaments: %w", err)
+	}
+	for rows.Next() {
+		var data string
+		var tournament Tournament
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &tournament); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error unmarshalling tournament: %w", err)
+		}
+		db.Tournaments = append(db.Tournaments, tournament)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query("SELECT data, before FROM events WHERE guild_id = ? ORDER BY id", guildID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading events: %w", err)
+	}
+	for rows.Next() {
+		var data string
+		var before sql.NullString
+		var event Event
+		if err := rows.Scan(&data, &before); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error unmarshalling event: %w", err)
+		}
+		if before.Valid {
+			event.Before = json.RawMessage(before.String)
+		}
+		db.Events = append(db.Events, event)
+	}
+	rows.Close()
+
+	var settings string
+	err = s.db.QueryRow("SELECT data FROM settings WHERE guild_id = ?", guildID).Scan(&settings)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("error reading settings: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(settings), &db.Settings); err != nil {
+			return nil, fmt.Errorf("error unmarshalling settings: %w", err)
+		}
+	}
+	return db, nil
+}
+
+func (s *sqliteStore) Save(db *Database) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		for _, table := range sqliteGuildTables {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE guild_id = ?", db.GuildID); err != nil {
+				return fmt.Errorf("error clearing %s: %w", table, err)
+			}
+		}
+		if err := insertPlayers(tx, db.GuildID, db.Players); err != nil {
+			return err
+		}
+		if err := insertTables(tx, db.GuildID, db.Tables); err != nil {
+			return err
+		}
+		for _, tournament := range db.Tournaments {
+			if err := upsertTournament(tx, db.GuildID, tournament); err != nil {
+				return err
+			}
+		}
+		for _, event := range db.Events {
+			if err := insertEvent(tx, db.GuildID, event); err != nil {
+				return err
+			}
+		}
+		return upsertSettings(tx, db.GuildID, db.Settings)
+	})
+}
+
+func (s *sqliteStore) SavePlayers(guildID string, players []Player, events []Event) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM players WHERE guild_id = ?", guildID); err != nil {
+			return fmt.Errorf("error clearing players: %w", err)
+		}
+		if err := insertPlayers(tx, guildID, players); err != nil {
+			return err
+		}
+		return insertEvents(tx, guildID, events)
+	})
+}
+
+func (s *sqliteStore) SaveTables(guildID string, tables []Table, events []Event) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM venue_tables WHERE guild_id = ?", guildID); err != nil {
+			return fmt.Errorf("error clearing tables: %w", err)
+		}
+		if err := insertTables(tx, guildID, tables); err != nil {
+			return err
+		}
+		return insertEvents(tx, guildID, events)
+	})
+}
+
+func (s *sqliteStore) SaveTournament(guildID string, tournament Tournament, events []Event) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if err := upsertTournament(tx, guildID, tournament); err != nil {
+			return err
+		}
+		return insertEvents(tx, guildID, events)
+	})
+}
+
+func (s *sqliteStore) SaveSettings(guildID string, settings Settings, events []Event) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		if err := upsertSettings(tx, guildID, settings); err != nil {
+			return err
+		}
+		return insertEvents(tx, guildID, events)
+	})
+}
+
+func (s *sqliteStore) FindMatch(guildID string, matchID string) (*Match, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM matches WHERE guild_id = ? AND match_id = ? AND tournament_id =
+		(SELECT id FROM tournaments WHERE guild_id = ? ORDER BY position DESC LIMIT 1)`, guildID, matchID, guildID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading match: %w", err)
+	}
+	var match Match
+	if err := json.Unmarshal([]byte(data), &match); err != nil {
+		return nil, fmt.Errorf("error unmarshalling match: %w", err)
+	}
+	return &match, nil
+}
+
+func (s *sqliteStore) PlayerMatches(guildID string, player string) ([]Match, error) {
+	rows, err := s.db.Query(`SELECT m.data FROM matches m JOIN tournaments t ON t.guild_id = m.guild_id AND t.id = m.tournament_id
+		WHERE m.guild_id = ? AND (m.player1 = ? OR m.player2 = ?) ORDER BY t.position, m.rowid`, guildID, player, player)
+	if err != nil {
+		return nil, fmt.Errorf("error reading matches: %w", err)
+	}
+	defer rows.Close()
+	var matches []Match
+	for rows.Next() {
+		var data string
+		var match Match
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &match); err != nil {
+			return nil, fmt.Errorf("error unmarshalling match: %w", err)
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// Inserts the players of a server in order
+func insertPlayers(tx *sql.Tx, guildID string, players []Player) error {
+	for position, player := range players {
+		_, err := tx.Exec("INSERT INTO players (guild_id, position, id, username, seed, rating, discord_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			guildID, position, player.ID, player.Username, player.Seed, player.Rating, player.DiscordID)
+		if err != nil {
+			return fmt.Errorf("error saving player %s: %w", player.Username, err)
+		}
+	}
+	return nil
+}
+
+// Inserts the tables of a server in order
+func insertTables(tx *sql.Tx, guildID string, tables []Table) error {
+	for position, table := range tables {
+		_, err := tx.Exec("INSERT INTO venue_tables (guild_id, position, id, available, match_id) VALUES (?, ?, ?, ?, ?)",
+			guildID, position, table.ID, table.Available, table.MatchID)
+		if err != nil {
+			return fmt.Errorf("error saving table %s: %w", table.ID, err)
+		}
+	}
+	return nil
+}
+
+// Adds or replaces a tournament and updates the index of its matches. Only the
+// matches that changed are written.
+func upsertTournament(tx *sql.Tx, guildID string, tournament Tournament) error {
+	data, err := json.Marshal(tournament)
+	if err != nil {
+		return fmt.Errorf("error marshalling tournament: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO tournaments (guild_id, id, position, data)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position) + 1, 0) FROM tournaments WHERE guild_id = ?), ?)
+		ON CONFLICT (guild_id, id) DO UPDATE SET data = excluded.data`, guildID, tournament.ID, guildID, string(data))
+	if err != nil {
+		return fmt.Errorf("error saving tournament %s: %w", tournament.ID, err)
+	}
+
+	var matchIDs []string
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			matchIDs = append(matchIDs, match.ID)
+			data, err := json.Marshal(match)
+			if err != nil {
+				return fmt.Errorf("error marshalling match: %w", err)
+			}
+			_, err = tx.Exec(`INSERT INTO matches (guild_id, tournament_id, match_id, player1, player2, winner, data) VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (guild_id, tournament_id, match_id) DO UPDATE SET player1 = excluded.player1, player2 = excluded.player2,
+				winner = excluded.winner, data = excluded.data WHERE matches.data != excluded.data`,
+				guildID, tournament.ID, match.ID, match.Player1, match.Player2, match.Winner, string(data))
+			if err != nil {
+				return fmt.Errorf("error saving match %s: %w", match.ID, err)
+			}
+		}
+	}
+
+	// Matches dropped from the tournament, e.g. by an undo
+	ids, err := json.Marshal(matchIDs)
+	if err != nil {
+		return fmt.Errorf("error marshalling matches: %w", err)
+	}
+	_, err = tx.Exec("DELETE FROM matches WHERE guild_id = ? AND tournament_id = ? AND match_id NOT IN (SELECT value FROM json_each(?))",
+		guildID, tournament.ID, string(ids))
+	if err != nil {
+		return fmt.Errorf("error clearing matches: %w", err)
+	}
+	return nil
+}
+
+// Inserts an event, its history apart so it can be dropped once too old
+func insertEvent(tx *sql.Tx, guildID string, event Event) error {
+	before := sql.NullString{String: string(event.Before), Valid: event.Before != nil}
+	event.Before = nil
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshalling event: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO events (guild_id, id, data, before) VALUES (?, ?, ?, ?)", guildID, event.ID, string(data), before)
+	if err != nil {
+		return fmt.Errorf("error saving event: %w", err)
+	}
+	return nil
+}
+
+// Adds events to the log of a server and drops the history of events too old to be undone
+func insertEvents(tx *sql.Tx, guildID string, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for _, event := range events {
+		if err := insertEvent(tx, guildID, event); err != nil {
+			return err
+		}
+	}
+	last := events[len(events)-1].ID
+	_, err := tx.Exec("UPDATE events SET before = NULL WHERE guild_id = ? AND id <= ?", guildID, last-undoDepth)
+	if err != nil {
+		return fmt.Errorf("error trimming history: %w", err)
+	}
+	return nil
+}
+
+// Adds or replaces the settings of a server
+func upsertSettings(tx *sql.Tx, guildID string, settings Settings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("error marshalling settings: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO settings (guild_id, data) VALUES (?, ?) ON CONFLICT (guild_id) DO UPDATE SET data = excluded.data",
+		guildID, string(data))
+	if err != nil {
+		return fmt.Errorf("error saving settings: %w", err)
+	}
+	return nil
+}
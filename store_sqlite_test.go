@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+// Opens an empty SQLite store in a temporary file
+func openTestSQLiteStore(t *testing.T) *sqliteStore {
+	t.Helper()
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "smashbot.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// Fails when two values are not saved as the same JSON
+func assertSameJSON(t *testing.T, want any, got any) {
+	t.Helper()
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(wantJSON) != string(gotJSON) {
+		t.Fatalf("expected\n%s\ngot\n%s", wantJSON, gotJSON)
+	}
+}
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	store := openTestSQLiteStore(t)
+
+	saved, err := state.snapshot("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameJSON(t, saved, loaded)
+
+	// Record a result and save only the tournament
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := getCurrentTournament(db).Rounds[0].Matches[0]
+	err = updateMatchResult(db, match.ID, match.Player1, "")
+	unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err = state.snapshot("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveTournament("guild", *getCurrentTournament(saved), nil); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.Load("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The event of the result went to the JSON store only
+	assertSameJSON(t, saved.Tournaments, loaded.Tournaments)
+
+	found, err := store.FindMatch("guild", match.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.Winner != match.Player1 {
+		t.Fatalf("expected %s won by %s, got %+v", match.ID, match.Player1, found)
+	}
+	if found, err := store.FindMatch("guild", "R9M9"); err != nil || found != nil {
+		t.Errorf("expected no match R9M9, got %+v, %v", found, err)
+	}
+	if found, err := store.FindMatch("other", match.ID); err != nil || found != nil {
+		t.Errorf("found %s in another server: %+v, %v", match.ID, found, err)
+	}
+
+	matches, err := store.PlayerMatches("guild", match.Player1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 || matches[0].ID != match.ID {
+		t.Errorf("expected the matches of %s to start with %s, got %+v", match.Player1, match.ID, matches)
+	}
+	for _, played := range matches {
+		if played.Player1 != match.Player1 && played.Player2 != match.Player1 {
+			t.Errorf("%s is not played by %s", played.ID, match.Player1)
+		}
+	}
+}
+
+func TestSQLiteStoreClaimLegacy(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	store := openTestSQLiteStore(t)
+
+	legacy, err := state.snapshot("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.GuildID = legacyGuildID
+	if err := store.Save(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSettings("busy", Settings{ReportTimeout: 5}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SavePlayers("taken", []Player{{ID: "1", Username: "alice"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ClaimLegacy("taken"); err != errGuildHasData {
+		t.Fatalf("a server with players claimed the legacy data: %v", err)
+	}
+	// Settings alone do not count as data of the server
+	if err := store.ClaimLegacy("busy"); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := store.Load("busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed.Players) != 4 || len(claimed.Tournaments) != 1 {
+		t.Fatalf("expected 4 players and 1 tournament, got %d and %d", len(claimed.Players), len(claimed.Tournaments))
+	}
+	match := claimed.Tournaments[0].Rounds[0].Matches[0]
+	if found, err := store.FindMatch("busy", match.ID); err != nil || found == nil {
+		t.Errorf("the matches of the claimed tournament were not moved: %+v, %v", found, err)
+	}
+	if err := store.ClaimLegacy("other"); err != errNoLegacyData {
+		t.Errorf("the legacy data was claimed twice: %v", err)
+	}
+}
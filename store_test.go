@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Opens a JSON store in a temporary directory, saved once per username so
+// each older save ends up in a snapshot
+func openTestJSONStore(t *testing.T, saves ...string) *jsonStore {
+	t.Helper()
+	store := newJSONStore(filepath.Join(t.TempDir(), "database.json"))
+	for _, username := range saves {
+		if err := store.SavePlayers("guild", []Player{{ID: "1", Username: username}}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// Returns the username of the single player saved by openTestJSONStore
+func savedUsername(t *testing.T, store *jsonStore) string {
+	t.Helper()
+	db, err := store.Load("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Players) != 1 {
+		t.Fatalf("expected 1 player, got %d", len(db.Players))
+	}
+	return db.Players[0].Username
+}
+
+func TestRecoverFromSnapshot(t *testing.T) {
+	store := openTestJSONStore(t, "first", "second", "third")
+	if err := os.WriteFile(store.path, []byte("{garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last save is lost, the one before it is in the newest snapshot
+	if username := savedUsername(t, store); username != "second" {
+		t.Fatalf("expected the newest snapshot, got %s", username)
+	}
+	file, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parseStorage(file); err != nil {
+		t.Errorf("the recovered data was not written back: %v", err)
+	}
+}
+
+func TestRecoverSkipsCorruptSnapshots(t *testing.T) {
+	store := openTestJSONStore(t, "first", "second", "third")
+	for _, path := range []string{store.path, store.snapshotPath(1)} {
+		if err := os.WriteFile(path, []byte("{garbage"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if username := savedUsername(t, store); username != "first" {
+		t.Fatalf("expected the oldest snapshot, got %s", username)
+	}
+}
+
+func TestNewerSchemaIsNotRecovered(t *testing.T) {
+	store := openTestJSONStore(t, "first", "second")
+	newer := []byte(fmt.Sprintf(`{"schema_version": %d, "guilds": {}}`, currentSchemaVersion+1))
+	if err := os.WriteFile(store.path, newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Load("guild"); !errors.Is(err, errNewerSchema) {
+		t.Fatalf("expected a newer schema error, got %v", err)
+	}
+	// The data of the newer bot must not be replaced by an older snapshot
+	file, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(file) != string(newer) {
+		t.Errorf("the file of a newer schema was overwritten:\n%s", file)
+	}
+}
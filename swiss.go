@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Minimum win percentage counted for an opponent, so a player is not punished
+// too hard for having faced someone who dropped every set
+const swissMinOpponentWinPct = 1.0 / 3.0
+
+// Returns the default number of Swiss rounds for a number of players
+func defaultSwissRounds(numPlayers int) int {
+	return int(math.Ceil(math.Log2(float64(numPlayers))))
+}
+
+// Returns the most Swiss rounds a number of players can always be paired for
+// without rematches. Counting the bye as a player, each player has at least
+// half of the field left to face until then, which always leaves a pairing for
+// everyone (Dirac's theorem). Past it, a round can have no pairing left.
+func maxSwissRounds(numPlayers int) int {
+	return (numPlayers + 1) / 2
+}
+
+// Computes the standings of a Swiss phase, ranked by set wins, then Buchholz
+// (sum of the opponents' wins), then opponents' win percentage. A bye counts as a win.
+func computeSwissStandings(tournament *Tournament, phase int) []Standing {
+	players := tournament.Phases[phase].Pools[0]
+	standings := make(map[string]*Standing, len(players))
+	for _, player := range players {
+		standings[player] = &Standing{Player: player}
+	}
+
+	opponents := make(map[string][]string)
+	for _, round := range tournament.Rounds {
+		if round.Phase != phase {
+			continue
+		}
+		for _, match := range round.Matches {
+			if match.Winner == "" {
+				continue
+			}
+			if match.Bye {
+				standings[match.Winner].Wins++
+				standings[match.Winner].Byes++
+				continue
+			}
+			loser := matchLoser(match)
+			standings[match.Winner].Wins++
+			standings[loser].Losses++
+			opponents[match.Winner] = append(opponents[match.Winner], loser)
+			opponents[loser] = append(opponents[loser], match.Winner)
+
+			winnerGames, loserGames := match.Player1Score, match.Player2Score
+			if match.Winner == match.Player2 {
+				winnerGames, loserGames = loserGames, winnerGames
+			}
+			standings[match.Winner].GamesWon += winnerGames
+			standings[match.Winner].GamesLost += loserGames
+			standings[loser].GamesWon += loserGames
+			standings[loser].GamesLost += winnerGames
+		}
+	}
+
+	for _, player := range players {
+		var winPctTotal float64
+		for _, opponent := range opponents[player] {
+			opp := standings[opponent]
+			standings[player].Buchholz += opp.Wins
+			winPct := swissMinOpponentWinPct
+			if played := opp.Wins + opp.Losses; played > 0 {
+				winPct = math.Max(winPct, float64(opp.Wins)/float64(played))
+			}
+			winPctTotal += winPct
+		}
+		if len(opponents[player]) > 0 {
+			standings[player].OpponentWinPct = winPctTotal / float64(len(opponents[player]))
+		}
+	}
+
+	result := make([]Standing, 0, len(players))
+	for _, player := range players {
+		result = append(result, *standings[player])
+	}
+	sort.SliceStable(result, func(a, b int) bool {
+		sa, sb := result[a], result[b]
+		if sa.Wins != sb.Wins {
+			return sa.Wins > sb.Wins
+		}
+		if sa.Buchholz != sb.Buchholz {
+			return sa.Buchholz > sb.Buchholz
+		}
+		return sa.OpponentWinPct > sb.OpponentWinPct
+	})
+	return result
+}
+
+// Creates the next round of the current Swiss phase from the standings. Players
+// are paired with the closest record possible and never twice with the same
+// opponent. With an odd number of players, the lowest ranked player who has not
+// had a bye yet gets one.
+func startNextSwissRound(tournament *Tournament) error {
+	phaseIndex := tournament.CurrentPhase
+	phase := currentPhase(tournament)
+
+	played := 0
+	met := make(map[string]map[string]bool)
+	for _, round := range tournament.Rounds {
+		if round.Phase != phaseIndex {
+			continue
+		}
+		played++
+		for _, match := range round.Matches {
+			if match.Bye {
+				continue
+			}
+			if met[match.Player1] == nil {
+				met[match.Player1] = make(map[string]bool)
+			}
+			if met[match.Player2] == nil {
+				met[match.Player2] = make(map[string]bool)
+			}
+			met[match.Player1][match.Player2] = true
+			met[match.Player2][match.Player1] = true
+		}
+	}
+	if played >= phase.SwissRounds {
+		return nil
+	}
+
+	standings := computeSwissStandings(tournament, phaseIndex)
+	ranked := make([]string, len(standings))
+	for i, standing := range standings {
+		ranked[i] = standing.Player
+	}
+	// Players are in seed order before the first round, fold the field so the
+	// top half of the seeds faces the bottom half
+	if played == 0 {
+		half := (len(ranked) + 1) / 2
+		folded := make([]string, 0, len(ranked))
+		for k := 0; k < half; k++ {
+			folded = append(folded, ranked[k])
+			if k+half < len(ranked) {
+				folded = append(folded, ranked[k+half])
+			}
+		}
+		ranked = folded
+	}
+
+	byeCandidates := []string{""}
+	if len(ranked)%2 == 1 {
+		byeCandidates = nil
+		for i := len(standings) - 1; i >= 0; i-- {
+			if standings[i].Byes == 0 {
+				byeCandidates = append(byeCandidates, standings[i].Player)
+			}
+		}
+		// Everyone already had a bye, start over from the bottom of the standings
+		if len(byeCandidates) == 0 {
+			for i := len(standings) - 1; i >= 0; i-- {
+				byeCandidates = append(byeCandidates, standings[i].Player)
+			}
+		}
+	}
+
+	for _, bye := range byeCandidates {
+		var remaining []string
+		for _, player := range ranked {
+			if player != bye {
+				remaining = append(remaining, player)
+			}
+		}
+		pairs, ok := pairSwissPlayers(remaining, met)
+		if !ok {
+			continue
+		}
+
+		number := played + 1
+		round := Round{
+			ID:      fmt.Sprintf("S%d", number),
+			Phase:   phaseIndex,
+			Number:  number,
+			Bracket: BracketSwiss,
+		}
+		for m, pair := range pairs {
+			round.Matches = append(round.Matches, Match{
+				ID:      fmt.Sprintf("S%dM%d", number, m+1),
+				Player1: pair[0],
+				Player2: pair[1],
+				Pool:    1,
+				Bracket: BracketSwiss,
+			})
+		}
+		if bye != "" {
+			round.Matches = append(round.Matches, Match{
+				ID:      fmt.Sprintf("S%dM%d", number, len(pairs)+1),
+				Player1: bye,
+				Winner:  bye,
+				Bye:     true,
+				Pool:    1,
+				Bracket: BracketSwiss,
+			})
+		}
+		tournament.Rounds = append(tournament.Rounds, round)
+		return nil
+	}
+	return fmt.Errorf("no pairing without a rematch is left for Swiss round %d", played+1)
+}
+
+// Pairs players in ranking order, each with the best ranked player they have not
+// met yet, backtracking when the rest of the field cannot be paired
+func pairSwissPlayers(players []string, met map[string]map[string]bool) ([][2]string, bool) {
+	if len(players) == 0 {
+		return nil, true
+	}
+	first := players[0]
+	for k := 1; k < len(players); k++ {
+		opponent := players[k]
+		if met[first][opponent] {
+			continue
+		}
+		rest := make([]string, 0, len(players)-2)
+		rest = append(rest, players[1:k]...)
+		rest = append(rest, players[k+1:]...)
+		if pairs, ok := pairSwissPlayers(rest, met); ok {
+			return append([][2]string{{first, opponent}}, pairs...), true
+		}
+	}
+	return nil, false
+}
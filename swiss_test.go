@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Returns a Swiss tournament of the given players in seed order, before its
+// first round is paired
+func newTestSwiss(players []string, rounds int) *Tournament {
+	return &Tournament{
+		Phases: []Phase{{Format: FormatSwiss, Pools: [][]string{players}, SwissRounds: rounds}},
+		Status: TournamentStatusOngoing,
+	}
+}
+
+// Pairs and plays every Swiss round, the winner of each set picked at random,
+// and returns the standings each round was paired from
+func playSwiss(t *testing.T, tournament *Tournament, random *rand.Rand) [][]Standing {
+	t.Helper()
+	var history [][]Standing
+	for tournament.Status != TournamentStatusComplete {
+		history = append(history, computeSwissStandings(tournament, 0))
+		if err := startNextSwissRound(tournament); err != nil {
+			t.Fatal(err)
+		}
+		if len(tournament.Rounds) == 1 {
+			startPhase(tournament, nil)
+		} else {
+			updateTournamentProgress(tournament)
+		}
+
+		round := &tournament.Rounds[tournament.CurrentRound]
+		for m := range round.Matches {
+			match := &round.Matches[m]
+			if match.Winner != "" {
+				continue
+			}
+			if random.Intn(2) == 0 {
+				completeMatch(tournament, match, match.Player1, 2, random.Intn(2))
+			} else {
+				completeMatch(tournament, match, match.Player2, random.Intn(2), 2)
+			}
+		}
+		updateTournamentProgress(tournament)
+	}
+	return history
+}
+
+func TestSwissRoundsWithoutRematches(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for n := 2; n <= 16; n++ {
+		rounds := maxSwissRounds(n)
+		if _, err := buildPhases(TournamentOptions{Format: FormatSwiss, SwissRounds: rounds + 1}, n); err == nil {
+			t.Errorf("%d rounds were accepted for %d players", rounds+1, n)
+		}
+		if _, err := buildPhases(TournamentOptions{Format: FormatSwiss, SwissRounds: rounds}, n); err != nil {
+			t.Fatal(err)
+		}
+
+		// Results change the pairings, so play each field many times
+		for run := 0; run < 50; run++ {
+			tournament := newTestSwiss(seededPlayers(n), rounds)
+			playSwiss(t, tournament, random)
+			if len(tournament.Rounds) != rounds {
+				t.Fatalf("%d players played %d rounds instead of %d", n, len(tournament.Rounds), rounds)
+			}
+
+			met := make(map[[2]string]string)
+			for _, round := range tournament.Rounds {
+				seated := make(map[string]bool)
+				for _, match := range round.Matches {
+					for _, player := range []string{match.Player1, match.Player2} {
+						if player == "" {
+							continue
+						}
+						if seated[player] {
+							t.Fatalf("%s plays twice in %s", player, round.ID)
+						}
+						seated[player] = true
+					}
+					if match.Bye {
+						continue
+					}
+					pair := [2]string{match.Player1, match.Player2}
+					if pair[0] > pair[1] {
+						pair[0], pair[1] = pair[1], pair[0]
+					}
+					if previous, ok := met[pair]; ok {
+						t.Fatalf("%s and %s meet in %s and %s", pair[0], pair[1], previous, match.ID)
+					}
+					met[pair] = match.ID
+				}
+				if len(seated) != n {
+					t.Fatalf("%d of %d players are in %s", len(seated), n, round.ID)
+				}
+			}
+		}
+	}
+}
+
+func TestSwissByesGoToLowestRankedOnce(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	for run := 0; run < 50; run++ {
+		tournament := newTestSwiss(seededPlayers(9), maxSwissRounds(9))
+		history := playSwiss(t, tournament, random)
+
+		hadBye := make(map[string]bool)
+		for r, round := range tournament.Rounds {
+			bye := round.Matches[len(round.Matches)-1]
+			if !bye.Bye {
+				t.Fatalf("%s has no bye with 9 players", round.ID)
+			}
+			if hadBye[bye.Winner] {
+				t.Fatalf("%s gets a second bye in %s", bye.Winner, round.ID)
+			}
+			lowest := ""
+			for s := len(history[r]) - 1; s >= 0 && lowest == ""; s-- {
+				if !hadBye[history[r][s].Player] {
+					lowest = history[r][s].Player
+				}
+			}
+			if bye.Winner != lowest {
+				t.Errorf("the bye of %s goes to %s instead of %s, the lowest ranked player without one", round.ID, bye.Winner, lowest)
+			}
+			hadBye[bye.Winner] = true
+		}
+	}
+}
+
+func TestSwissStandingsTiebreakers(t *testing.T) {
+	// Every player but ana and fay wins once. cid beat stronger opponents than
+	// bob and dan, who faced opponents with as many wins but not as many sets won.
+	players := []string{"ana", "bob", "cid", "dan", "eve", "fay"}
+	tournament := &Tournament{Phases: []Phase{{Format: FormatSwiss, Pools: [][]string{players}, SwissRounds: 2}}}
+	results := [][][2]string{
+		{{"ana", "bob"}, {"cid", "dan"}, {"eve", "fay"}},
+		{{"ana", "cid"}, {"dan", "eve"}, {"bob", "fay"}},
+	}
+	for r, round := range results {
+		played := Round{Number: r + 1, Bracket: BracketSwiss}
+		for _, result := range round {
+			played.Matches = append(played.Matches, Match{Player1: result[0], Player2: result[1], Winner: result[0], Player1Score: 2, Player2Score: 1})
+		}
+		tournament.Rounds = append(tournament.Rounds, played)
+	}
+
+	standings := computeSwissStandings(tournament, 0)
+	want := []string{"ana", "cid", "bob", "dan", "eve", "fay"}
+	for s, player := range standingOrder(standings) {
+		if player != want[s] {
+			t.Fatalf("expected %v, got %v", want, standingOrder(standings))
+		}
+	}
+	if standings[1].Buchholz != 3 || standings[2].Buchholz != 2 || standings[3].Buchholz != 2 {
+		t.Errorf("got Buchholz %d for cid, %d for bob and %d for dan, expected 3, 2 and 2",
+			standings[1].Buchholz, standings[2].Buchholz, standings[3].Buchholz)
+	}
+	if standings[2].OpponentWinPct <= standings[3].OpponentWinPct {
+		t.Errorf("bob has opponents' win percentage %.2f, not above dan's %.2f", standings[2].OpponentWinPct, standings[3].OpponentWinPct)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Longest thread name Discord accepts, in characters
+const maxThreadName = 100
+
+// Changes the channel match threads are opened under and whether they are
+// private. Without a channel, no thread is opened anymore.
+func setMatchThreads(db *Database, channelID string, private bool) error {
+	db.Settings.ThreadChannel = channelID
+	db.Settings.PrivateThreads = private
+	log.Print("Match threads updated successfully")
+	return saveSettings(db)
+}
+
+// Returns the ready matches that need a thread: a new one, or their archived one
+// opened again after their players changed
+func threadsToOpen(db *Database) []Match {
+	tournament := getCurrentTournament(db)
+	if tournament == nil || db.Settings.ThreadChannel == "" {
+		return nil
+	}
+	var open []Match
+	for _, match := range readyMatches(tournament) {
+		if match.ThreadID == "" || match.ThreadArchived {
+			open = append(open, match)
+		}
+	}
+	return open
+}
+
+// Returns the matches whose thread is open although they are not played
+// anymore: their result was recorded or one of their players was taken back
+func threadsToArchive(db *Database) []Match {
+	tournament := getCurrentTournament(db)
+	if tournament == nil {
+		return nil
+	}
+	var archive []Match
+	for _, round := range tournament.Rounds {
+		for _, match := range round.Matches {
+			if match.ThreadID != "" && !match.ThreadArchived && !isMatchReady(match) {
+				archive = append(archive, match)
+			}
+		}
+	}
+	return archive
+}
+
+// Returns the name of the thread of a match
+func threadName(match Match) string {
+	name := fmt.Sprintf("%s - %s vs %s", match.ID, match.Player1, match.Player2)
+	// The limit counts characters, not bytes
+	if runes := []rune(name); len(runes) > maxThreadName {
+		name = string(runes[:maxThreadName])
+	}
+	return name
+}
+
+// Opens the thread of a match, or its archived thread again, adds both players
+// and posts the report panel of the match in it. Returns the thread ID.
+func openMatchThread(s *discordgo.Session, db *Database, match Match) (string, error) {
+	threadID := match.ThreadID
+	if threadID == "" {
+		threadType := discordgo.ChannelTypeGuildPublicThread
+		if db.Settings.PrivateThreads {
+			threadType = discordgo.ChannelTypeGuildPrivateThread
+		}
+		thread, err := s.ThreadStartComplex(db.Settings.ThreadChannel, &discordgo.ThreadStart{
+			Name:                threadName(match),
+			AutoArchiveDuration: 1440,
+			Type:                threadType,
+		})
+		if err != nil {
+			return "", fmt.Errorf("error creating thread: %w", err)
+		}
+		threadID = thread.ID
+	} else {
+		archived := false
+		name := threadName(match)
+		if _, err := s.ChannelEditComplex(threadID, &discordgo.ChannelEdit{Name: name, Archived: &archived}); err != nil {
+			return "", fmt.Errorf("error opening thread again: %w", err)
+		}
+	}
+
+	for _, player := range []string{match.Player1, match.Player2} {
+		if discordID := playerDiscordID(db, player); discordID != "" {
+			if err := s.ThreadMemberAdd(threadID, discordID); err != nil {
+				log.Printf("Error adding %s to thread: %v", player, err)
+			}
+		}
+	}
+	embed, components := matchPanel(match, "")
+	_, err := s.ChannelMessageSendComplex(threadID, &discordgo.MessageSend{
+		Content:    playerMentions(db, []string{match.Player1, match.Player2}) + ", strike stages, report your score and call a TO here.",
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil {
+		log.Printf("Error sending match panel: %v", err)
+	}
+	return threadID, nil
+}
+
+// Posts the result of a match in its thread, or why it stopped, and archives it
+func archiveMatchThread(s *discordgo.Session, match Match) error {
+	description := "The players of this match changed, the thread opens again once both are known."
+	if match.Winner != "" {
+		description = fmt.Sprintf("%s %d - %d %s\n**%s** wins", match.Player1, match.Player1Score, match.Player2Score, match.Player2, match.Winner)
+	}
+	_, err := s.ChannelMessageSendEmbed(match.ThreadID, &discordgo.MessageEmbed{
+		Title:       "Match " + match.ID,
+		Description: description,
+		Color:       0x00FF00,
+	})
+	if err != nil {
+		log.Printf("Error sending result to thread: %v", err)
+	}
+	archived := true
+	if _, err := s.ChannelEditComplex(match.ThreadID, &discordgo.ChannelEdit{Archived: &archived}); err != nil {
+		return fmt.Errorf("error archiving thread: %w", err)
+	}
+	return nil
+}
+
+// Records the threads opened and archived for the matches of a tournament,
+// by match ID. Nothing is recorded when the tournament was cleared meanwhile.
+func saveMatchThreads(guildID string, tournamentID string, archived map[string]string, opened map[string]string) error {
+	db, unlock, err := state.acquire(guildID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	tournament := getCurrentTournament(db)
+	if tournament == nil || tournament.ID != tournamentID {
+		return nil
+	}
+	for matchID, threadID := range archived {
+		if match := findMatch(tournament, matchID); match != nil && match.ThreadID == threadID {
+			match.ThreadArchived = true
+		}
+	}
+	// A match over by now gets its thread archived by the next follow-up
+	for matchID, threadID := range opened {
+		if match := findMatch(tournament, matchID); match != nil {
+			match.ThreadID = threadID
+			match.ThreadArchived = false
+		}
+	}
+	return saveTournament(db, tournament)
+}
+
+// Opens a thread for each match of a server being played and archives the
+// threads of the matches that are over. Discord is reached without locking the
+// server, from its saved data, and the threads are recorded afterwards.
+func syncMatchThreads(s *discordgo.Session, guildID string) {
+	// Most changes open and archive nothing, the saved data tells without locking the server
+	if saved, err := state.snapshot(guildID); err != nil || len(threadsToOpen(saved))+len(threadsToArchive(saved)) == 0 {
+		return
+	}
+	unlock := state.lockThreads(guildID)
+	defer unlock()
+	// Read again, a follow-up running meanwhile may have handled the threads
+	saved, err := state.snapshot(guildID)
+	if err != nil {
+		log.Printf("Error loading database: %v", err)
+		return
+	}
+
+	archived := make(map[string]string)
+	for _, over := range threadsToArchive(saved) {
+		if err := archiveMatchThread(s, over); err != nil {
+			log.Printf("Error closing thread of match %s: %v", over.ID, err)
+			continue
+		}
+		archived[over.ID] = over.ThreadID
+	}
+	opened := make(map[string]string)
+	for _, ready := range threadsToOpen(saved) {
+		threadID, err := openMatchThread(s, saved, ready)
+		if err != nil {
+			log.Printf("Error opening thread of match %s: %v", ready.ID, err)
+			continue
+		}
+		opened[ready.ID] = threadID
+	}
+	if len(archived)+len(opened) == 0 {
+		return
+	}
+	if err := saveMatchThreads(guildID, getCurrentTournament(saved).ID, archived, opened); err != nil {
+		log.Printf("Error saving match threads: %v", err)
+		return
+	}
+	log.Print("Match threads updated successfully")
+}
+
+// Returns the threads of the matches of every tournament of a server
+func matchThreads(db *Database) []string {
+	var threads []string
+	for _, tournament := range db.Tournaments {
+		for _, round := range tournament.Rounds {
+			for _, match := range round.Matches {
+				if match.ThreadID != "" {
+					threads = append(threads, match.ThreadID)
+				}
+			}
+		}
+	}
+	return threads
+}
+
+// Deletes the threads of matches of tournaments that were cleared
+func deleteMatchThreads(s *discordgo.Session, threads []string) {
+	for _, threadID := range threads {
+		if _, err := s.ChannelDelete(threadID); err != nil {
+			log.Printf("Error deleting match thread: %v", err)
+		}
+	}
+	if len(threads) > 0 {
+		log.Print("Match threads deleted successfully")
+	}
+}
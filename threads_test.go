@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestMatchThreadsSavedOnceOpened(t *testing.T) {
+	startTestTournament(t, "guild", 4)
+	db, unlock, err := state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = setMatchThreads(db, "channel", false)
+	unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := state.snapshot("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := threadsToOpen(saved)
+	if len(open) != 2 {
+		t.Fatalf("expected 2 threads to open, got %d", len(open))
+	}
+	tournamentID := getCurrentTournament(saved).ID
+	opened := map[string]string{open[0].ID: "first", open[1].ID: "second"}
+	if err := saveMatchThreads("guild", tournamentID, nil, opened); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err = state.snapshot("guild"); err != nil {
+		t.Fatal(err)
+	}
+	if left := threadsToOpen(saved); len(left) != 0 {
+		t.Fatalf("%d threads are still to open", len(left))
+	}
+
+	// The result of the first match was recorded while its thread was opened
+	db, unlock, err = state.acquire("guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := findMatch(getCurrentTournament(db), open[0].ID)
+	err = updateMatchResult(db, match.ID, match.Player1, "")
+	unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved, err = state.snapshot("guild"); err != nil {
+		t.Fatal(err)
+	}
+	archive := threadsToArchive(saved)
+	if len(archive) != 1 || archive[0].ThreadID != "first" {
+		t.Fatalf("expected the thread first to archive, got %+v", archive)
+	}
+
+	// Threads of a tournament cleared meanwhile are not recorded on the next one
+	if err := saveMatchThreads("guild", tournamentID+"-cleared", map[string]string{open[0].ID: "first"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err = state.snapshot("guild"); err != nil {
+		t.Fatal(err)
+	}
+	if findMatch(getCurrentTournament(saved), open[0].ID).ThreadArchived {
+		t.Error("a thread was recorded on another tournament")
+	}
+	if err := saveMatchThreads("guild", tournamentID, map[string]string{open[0].ID: "first"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if saved, err = state.snapshot("guild"); err != nil {
+		t.Fatal(err)
+	}
+	if !findMatch(getCurrentTournament(saved), open[0].ID).ThreadArchived {
+		t.Error("the archived thread was not recorded")
+	}
+}